@@ -0,0 +1,331 @@
+package img2ansi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SAUCE holds the metadata written in the SAUCE record at the end of a
+// .ans file. See https://www.acid.org/info/sauce/sauce.htm.
+type SAUCE struct {
+	Title  string
+	Author string
+	Group  string
+	// Date defaults to the current date.
+	Date time.Time
+	// ICEColors enables 16 background colors. Without it, bright
+	// backgrounds blink on real hardware, so only the 8 normal colors
+	// are used for backgrounds.
+	ICEColors bool
+	// Font is the SAUCE font name; it defaults to "IBM VGA".
+	Font string
+}
+
+// cp437Blocks maps the block elements that exist in code page 437 to their
+// byte values.
+var cp437Blocks = map[rune]byte{
+	' ': 0x20,
+	'█': 0xDB,
+	'▄': 0xDC,
+	'▌': 0xDD,
+	'▐': 0xDE,
+	'▀': 0xDF,
+}
+
+// cp437Halves are the half blocks used to approximate quadrant glyphs.
+var cp437Halves = []rune{'▀', '▄', '▌', '▐'}
+
+// vgaColors is the standard VGA text mode palette, indexed by the CGA
+// color number. It fills in colors the Renderer's palette doesn't define.
+var vgaColors = [16]RGB{
+	{0x00, 0x00, 0x00}, {0xAA, 0x00, 0x00}, {0x00, 0xAA, 0x00}, {0xAA, 0x55, 0x00},
+	{0x00, 0x00, 0xAA}, {0xAA, 0x00, 0xAA}, {0x00, 0xAA, 0xAA}, {0xAA, 0xAA, 0xAA},
+	{0x55, 0x55, 0x55}, {0xFF, 0x55, 0x55}, {0x55, 0xFF, 0x55}, {0xFF, 0xFF, 0x55},
+	{0x55, 0x55, 0xFF}, {0xFF, 0x55, 0xFF}, {0x55, 0xFF, 0xFF}, {0xFF, 0xFF, 0xFF},
+}
+
+// cgaIndex returns the CGA color number (0-15) of a foreground or
+// background ANSI code, or -1 if the code has no 16-color equivalent.
+func cgaIndex(code string) int {
+	if strings.HasPrefix(code, "38;5;") || strings.HasPrefix(code, "48;5;") {
+		n, err := strconv.Atoi(code[5:])
+		if err != nil || n > 15 {
+			return -1
+		}
+		return n
+	}
+	n, err := strconv.Atoi(code)
+	if err != nil {
+		return -1
+	}
+	switch {
+	case n >= 30 && n <= 37:
+		return n - 30
+	case n >= 40 && n <= 47:
+		return n - 40
+	case n >= 90 && n <= 97:
+		return n - 90 + 8
+	case n >= 100 && n <= 107:
+		return n - 100 + 8
+	}
+	return -1
+}
+
+// ansEncoder converts block colors to CGA color numbers using the
+// Renderer's palette.
+type ansEncoder struct {
+	r       *Renderer
+	colors  [16]RGB
+	indices map[RGB]int
+	ice     bool
+}
+
+// newANSEncoder builds the CGA color table from the Renderer's palette,
+// falling back to VGA colors for numbers the palette doesn't define.
+func (r *Renderer) newANSEncoder(ice bool) *ansEncoder {
+	e := &ansEncoder{r: r, colors: vgaColors, indices: make(map[RGB]int), ice: ice}
+	defined := [16]bool{}
+	collect := func(om *OrderedMap) {
+		if om == nil {
+			return
+		}
+		om.Iterate(func(key, value interface{}) {
+			idx := cgaIndex(value.(string))
+			if idx >= 0 && !defined[idx] {
+				e.colors[idx] = rgbFromUint32(key.(uint32))
+				defined[idx] = true
+			}
+		})
+	}
+	collect(r.fgAnsi)
+	collect(r.bgAnsi)
+	for i := 15; i >= 0; i-- {
+		e.indices[e.colors[i]] = i
+	}
+	return e
+}
+
+// bgLimit returns the number of colors usable as backgrounds.
+func (e *ansEncoder) bgLimit() int {
+	if e.ice {
+		return 16
+	}
+	return 8
+}
+
+// nearest returns the color number among the first limit colors that
+// minimizes the summed distance to the given pixels.
+func (e *ansEncoder) nearest(pixels []RGB, limit int) (int, float64) {
+	best, bestError := 0, math.MaxFloat64
+	for i := 0; i < limit; i++ {
+		var err float64
+		for _, p := range pixels {
+			err += e.r.ColorMethod.Distance(p, e.colors[i])
+		}
+		if err < bestError {
+			best, bestError = i, err
+		}
+	}
+	return best, bestError
+}
+
+// encodeCell returns the CP437 byte and color numbers for a block, where
+// -1 marks a color the glyph doesn't show. Cells that are already CP437
+// block characters with encodable colors are kept as they are, swapping to
+// the complementary glyph if the background would otherwise need a bright
+// color. Everything else is re-solved as the half block, with the palette
+// colors, that best matches the cell's four quadrant colors.
+func (e *ansEncoder) encodeCell(block BlockRune) (byte, int, int) {
+	if block.Rune == ' ' || block.Rune == '█' {
+		solid := block.BG
+		if block.Rune == '█' {
+			solid = block.FG
+		}
+		if idx, ok := e.indices[solid]; ok {
+			if idx < e.bgLimit() {
+				return cp437Blocks[' '], -1, idx
+			}
+			return cp437Blocks['█'], idx, -1
+		}
+	}
+
+	fg, fgOK := e.indices[block.FG]
+	bg, bgOK := e.indices[block.BG]
+	if ch, native := cp437Blocks[block.Rune]; native && fgOK && bgOK {
+		if bg < e.bgLimit() {
+			return ch, fg, bg
+		}
+		if fg < e.bgLimit() {
+			complement := Blocks[15-blockIndex(block.Rune)].Rune
+			return cp437Blocks[complement], bg, fg
+		}
+	}
+
+	quad := getQuadrantsForRune(block.Rune)
+	var pixels [4]RGB
+	for i := 0; i < 4; i++ {
+		pixels[i] = block.BG
+		if isQuadrantActive(quad, i%2, i/2) {
+			pixels[i] = block.FG
+		}
+	}
+
+	var bestRune rune
+	var bestFG, bestBG int
+	bestError := math.MaxFloat64
+	for _, half := range cp437Halves {
+		halfQuad := getQuadrantsForRune(half)
+		var on, off []RGB
+		for i, p := range pixels {
+			if isQuadrantActive(halfQuad, i%2, i/2) {
+				on = append(on, p)
+			} else {
+				off = append(off, p)
+			}
+		}
+		f, fErr := e.nearest(on, 16)
+		b, bErr := e.nearest(off, e.bgLimit())
+		if fErr+bErr < bestError {
+			bestRune, bestFG, bestBG, bestError = half, f, b, fErr+bErr
+		}
+	}
+	return cp437Blocks[bestRune], bestFG, bestBG
+}
+
+// ansState tracks the attributes set on a DOS ANSI terminal.
+type ansState struct {
+	fg, bg      int
+	bold, blink bool
+}
+
+// sgr returns the escape sequence that moves the terminal from state s to
+// show fg on bg. A negative color keeps the current one. Turning bold or
+// blink off needs a full reset, since ANSI.SYS has no codes to clear them
+// individually.
+func (s *ansState) sgr(fg, bg int) string {
+	if fg < 0 {
+		fg = s.fg
+	}
+	if bg < 0 {
+		bg = s.bg
+	}
+	wantBold, wantBlink := fg >= 8, bg >= 8
+	var params []string
+	if (s.bold && !wantBold) || (s.blink && !wantBlink) {
+		params = append(params, "0")
+		*s = ansState{fg: 7, bg: 0}
+	}
+	if wantBold && !s.bold {
+		params = append(params, "1")
+	}
+	if wantBlink && !s.blink {
+		params = append(params, "5")
+	}
+	if fg%8 != s.fg%8 {
+		params = append(params, strconv.Itoa(30+fg%8))
+	}
+	if bg%8 != s.bg%8 {
+		params = append(params, strconv.Itoa(40+bg%8))
+	}
+	*s = ansState{fg: fg, bg: bg, bold: wantBold, blink: wantBlink}
+	if len(params) == 0 {
+		return ""
+	}
+	return ESC + "[" + strings.Join(params, ";") + "m"
+}
+
+// EncodeANS writes blocks as a classic CP437 .ans file followed by a SAUCE
+// record. Only the block characters that exist in CP437 (space, █, ▀, ▄,
+// ▌ and ▐) are used; quadrant glyphs are replaced by the half block and
+// palette colors that best match them. Colors are written as the 16 CGA
+// colors, with bright foregrounds as bold and bright backgrounds as blink,
+// which iCE color aware viewers show as bright backgrounds.
+//
+// Rows narrower than 80 columns end with CR LF. Wider rows rely on the
+// viewer wrapping at the SAUCE width.
+func (r *Renderer) EncodeANS(w io.Writer, blocks [][]BlockRune, sauce SAUCE) error {
+	if len(blocks) == 0 || len(blocks[0]) == 0 {
+		return fmt.Errorf("cannot encode an empty block grid")
+	}
+	e := r.newANSEncoder(sauce.ICEColors)
+	width := len(blocks[0])
+
+	var buf bytes.Buffer
+	buf.WriteString(ESC + "[0m")
+	state := ansState{fg: 7, bg: 0}
+	for _, row := range blocks {
+		for _, block := range row {
+			ch, fg, bg := e.encodeCell(block)
+			buf.WriteString(state.sgr(fg, bg))
+			buf.WriteByte(ch)
+		}
+		if width < 80 {
+			buf.WriteString(ESC + "[0m\r\n")
+			state = ansState{fg: 7, bg: 0}
+		}
+	}
+	buf.WriteString(ESC + "[0m")
+
+	fileSize := buf.Len()
+	buf.WriteByte(0x1A)
+	writeSAUCE(&buf, sauce, fileSize, width, len(blocks))
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// writeSAUCE appends the 128 byte SAUCE record for a character file.
+func writeSAUCE(buf *bytes.Buffer, sauce SAUCE, fileSize, width, height int) {
+	date := sauce.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	font := sauce.Font
+	if font == "" {
+		font = "IBM VGA"
+	}
+	var flags byte
+	if sauce.ICEColors {
+		flags |= 1
+	}
+
+	buf.WriteString("SAUCE00")
+	buf.WriteString(sauceField(sauce.Title, 35, ' '))
+	buf.WriteString(sauceField(sauce.Author, 20, ' '))
+	buf.WriteString(sauceField(sauce.Group, 20, ' '))
+	buf.WriteString(date.Format("20060102"))
+	binary.Write(buf, binary.LittleEndian, uint32(fileSize))
+	buf.WriteByte(1) // DataType: Character
+	buf.WriteByte(1) // FileType: ANSi
+	binary.Write(buf, binary.LittleEndian, uint16(width))
+	binary.Write(buf, binary.LittleEndian, uint16(height))
+	binary.Write(buf, binary.LittleEndian, uint16(0))
+	binary.Write(buf, binary.LittleEndian, uint16(0))
+	buf.WriteByte(0) // No comment block
+	buf.WriteByte(flags)
+	buf.WriteString(sauceField(font, 22, 0))
+}
+
+// sauceField pads or truncates s to n bytes, replacing characters outside
+// of printable ASCII with '?'.
+func sauceField(s string, n int, pad byte) string {
+	field := make([]byte, 0, n)
+	for _, c := range s {
+		if len(field) == n {
+			break
+		}
+		if c < 0x20 || c > 0x7E {
+			c = '?'
+		}
+		field = append(field, byte(c))
+	}
+	for len(field) < n {
+		field = append(field, pad)
+	}
+	return string(field)
+}
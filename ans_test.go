@@ -0,0 +1,96 @@
+package img2ansi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestEncodeANS(t *testing.T) {
+	t.Parallel()
+
+	r := NewRenderer(WithPalette("ansi16"))
+	black := RGB{0x00, 0x00, 0x00}
+	red := RGB{0xAA, 0x00, 0x00}
+	yellow := RGB{0xFF, 0xFF, 0x55}
+	blocks := [][]BlockRune{
+		{
+			{'▀', red, black},
+			{'▛', red, black},    // quadrant, must be re-solved
+			{'▄', black, yellow}, // bright background, must be swapped
+			{' ', red, yellow},   // bright solid
+		},
+	}
+
+	var buf bytes.Buffer
+	date := time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC)
+	sauce := SAUCE{Title: "Test", Author: "img2ansi", Date: date}
+	if err := r.EncodeANS(&buf, blocks, sauce); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	data := buf.Bytes()
+
+	if len(data) < 129 || data[len(data)-129] != 0x1A {
+		t.Fatal("Expected EOF marker before the SAUCE record")
+	}
+	art, record := data[:len(data)-129], data[len(data)-128:]
+
+	expected := ESC + "[0m" +
+		ESC + "[31m\xDF" + // red on black upper half
+		"\xDF" + // quadrant re-solved to a half block, same colors
+		ESC + "[1;33m\xDF" + // swapped: bright yellow fg on black bg
+		"\xDB" + // bright solid drawn as a full block
+		ESC + "[0m\r\n" + ESC + "[0m"
+	if string(art) != expected {
+		t.Errorf("Unexpected art:\n got %q\nwant %q", art, expected)
+	}
+
+	if string(record[:7]) != "SAUCE00" {
+		t.Fatalf("Expected SAUCE00 signature, got %q", record[:7])
+	}
+	if title := string(record[7:42]); title != "Test"+string(bytes.Repeat([]byte{' '}, 31)) {
+		t.Errorf("Unexpected title field %q", title)
+	}
+	if d := string(record[82:90]); d != "20240309" {
+		t.Errorf("Expected date 20240309, got %s", d)
+	}
+	if size := binary.LittleEndian.Uint32(record[90:94]); int(size) != len(art) {
+		t.Errorf("Expected file size %d, got %d", len(art), size)
+	}
+	if record[94] != 1 || record[95] != 1 {
+		t.Errorf("Expected character/ANSi data type, got %d/%d", record[94], record[95])
+	}
+	if w := binary.LittleEndian.Uint16(record[96:98]); w != 4 {
+		t.Errorf("Expected width 4, got %d", w)
+	}
+	if h := binary.LittleEndian.Uint16(record[98:100]); h != 1 {
+		t.Errorf("Expected height 1, got %d", h)
+	}
+	if record[105] != 0 {
+		t.Errorf("iCE colors flag should be off, got flags %08b", record[105])
+	}
+	if font := string(bytes.TrimRight(record[106:], "\x00")); font != "IBM VGA" {
+		t.Errorf("Expected IBM VGA font, got %q", font)
+	}
+}
+
+func TestEncodeANSICEColors(t *testing.T) {
+	t.Parallel()
+
+	r := NewRenderer(WithPalette("ansi16"))
+	blocks := [][]BlockRune{{{'▄', RGB{0, 0, 0}, RGB{0xFF, 0xFF, 0x55}}}}
+
+	var buf bytes.Buffer
+	if err := r.EncodeANS(&buf, blocks, SAUCE{ICEColors: true}); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	data := buf.Bytes()
+	// With iCE colors the bright background is kept as blink
+	if !bytes.Contains(data, []byte(ESC+"[5;30;43m\xDC")) {
+		t.Errorf("Expected blink bright background, got %q", data[:len(data)-129])
+	}
+	if data[len(data)-128+105]&1 == 0 {
+		t.Error("Expected iCE colors flag to be set")
+	}
+}
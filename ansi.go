@@ -2,6 +2,7 @@ package img2ansi
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -12,103 +13,234 @@ type AnsiEntry struct {
 type AnsiData []AnsiEntry
 
 
-// CompressANSI compresses an ANSI image by combining adjacent blocks with
-// the same foreground and background colors. The function takes an ANSI
-// image as a string and returns the more efficient ANSI image as a string.
+// CompressANSI compresses an ANSI image, such as the output of
+// RenderToAnsi, by parsing it into character cells and writing them back
+// with as few escape sequences as possible, in the same way as
+// CompressBlocks. It works on the SGR codes themselves rather than on
+// colors, so the output doesn't depend on the Renderer's palette and
+// keeps the codes of the input. Text that can't be written back from its
+// cells without changing it, for example because it has escape sequences
+// other than colors, bold, tabs or a SAUCE record, is returned unchanged.
 func (r *Renderer) CompressANSI(ansiImage string) string {
-	var compressed strings.Builder
-	var currentFg, currentBg, currentBlock string
-	var count int
-
-	lines := strings.Split(ansiImage, "\n")
-	for _, line := range lines {
-		segments := strings.Split(line, "\u001b[")
-		for _, segment := range segments {
-			if segment == "" {
-				continue
-			}
-			parts := strings.SplitN(segment, "m", 2)
-			if len(parts) != 2 {
-				continue
-			}
-			colorCode, block := parts[0], parts[1]
-			fg, bg := extractColors(colorCode)
-
-			// Optimize full block representation
-			if block == "█" {
-				bg = ""
-			} else if block == " " {
-				fg = ""
-			}
+	cells, _, exact := parseANSICells([]byte(ansiImage))
+	if !exact {
+		return ansiImage
+	}
+	e := newANSIEncoder(r)
+	var sb strings.Builder
+	for _, row := range e.internCodes(cells) {
+		e.writeRow(&sb, row)
+	}
+	e.finish(&sb)
+	return sb.String()
+}
 
-			// If any color or block changes, write the current block
-			// and start a new one
-			if fg != currentFg || bg != currentBg || block != currentBlock {
-				if count > 0 {
-					compressed.WriteString(
-						formatANSICode(
-							currentFg, currentBg, currentBlock, count))
-				}
-				currentFg, currentBg, currentBlock = fg, bg, block
-				count = 1
-			} else {
-				count++
+// internCodes returns cells as blocks whose colors are stand-ins for the
+// cells' SGR codes, and sets up the encoder to write those codes for
+// them. A basic, 256-color or 24-bit color gets one stand-in with both
+// its foreground and background code, so solid cells can still be drawn
+// either way. The default foreground and background are separate
+// stand-ins, each only usable in its own role.
+func (e *ansiEncoder) internCodes(cells [][]ansiCell) [][]BlockRune {
+	ids := make(map[string]RGB)
+	intern := func(code string, fg bool) RGB {
+		fgCode, bgCode := codePair(code, fg)
+		key := fgCode
+		if fgCode == "" {
+			key = bgCode
+		}
+		if id, ok := ids[key]; ok {
+			return id
+		}
+		n := len(ids)
+		id := RGB{uint8(n >> 16), uint8(n >> 8), uint8(n)}
+		ids[key] = id
+		e.fgCodes[id] = paletteCode{code: fgCode, inPalette: fgCode != ""}
+		e.bgCodes[id] = paletteCode{code: bgCode, inPalette: bgCode != ""}
+		return id
+	}
+
+	blocks := make([][]BlockRune, len(cells))
+	for y, row := range cells {
+		blocks[y] = make([]BlockRune, len(row))
+		for x, c := range row {
+			blocks[y][x] = BlockRune{
+				Rune: c.ch,
+				FG:   intern(c.state.code(true), true),
+				BG:   intern(c.state.code(false), false),
 			}
 		}
-		// Write the last block of the line
-		if count > 0 {
-			compressed.WriteString(
-				formatANSICode(currentFg, currentBg, currentBlock, count))
+	}
+	return blocks
+}
+
+// codePair returns the foreground and background codes for the color of
+// a foreground or background code. The default color only has a code in
+// its own role.
+func codePair(code string, fg bool) (string, string) {
+	if code == "" {
+		if fg {
+			return "39", ""
 		}
-		compressed.WriteString(fmt.Sprintf("%s[0m\n", ESC))
-		count = 0
-		currentFg, currentBg = "", "" // Reset colors at end of line
-	}
-
-	return compressed.String()
-}
-
-// formatANSICode formats an ANSI color code with the given foreground and
-// background colors, block character, and count. The function returns the
-// ANSI color code as a string, with the foreground and background colors
-// formatted as ANSI color codes, the block character repeated count times.
-func formatANSICode(fg, bg, block string, count int) string {
-	var code strings.Builder
-	code.WriteString(ESC)
-	code.WriteByte('[')
-	if fg != "" {
-		code.WriteString(fg)
-		if bg != "" {
-			code.WriteByte(';')
+		return "", "49"
+	}
+	if rest, ok := strings.CutPrefix(code, "38;"); ok {
+		return code, "48;" + rest
+	}
+	if rest, ok := strings.CutPrefix(code, "48;"); ok {
+		return "38;" + rest, code
+	}
+	n, _ := strconv.Atoi(code)
+	if (n >= 30 && n <= 37) || (n >= 90 && n <= 97) {
+		return code, strconv.Itoa(n + 10)
+	}
+	return strconv.Itoa(n - 10), code
+}
+
+// CompressBlocks renders a block grid to ANSI text with as few escape
+// sequences as possible. It tracks the colors the terminal has set and
+// only emits the ones that change, so a cell whose foreground alone
+// differs costs a single foreground code. A space only needs its
+// background and a full block only its foreground, so solid cells can be
+// drawn either way; with ComplementSwap, quadrant glyphs may also be
+// drawn as their complement with the colors swapped. The cheapest
+// combination of these for each row is chosen by SwapComplements.
+//
+// Colors that aren't in the palette are written as 24-bit codes. Each
+// line ends with a reset unless LineReset is off, in which case colors
+// carry over to the next line and only the end of the image is reset.
+func (r *Renderer) CompressBlocks(blocks [][]BlockRune) string {
+	var sb strings.Builder
+	_ = r.Encode(&sb, blocks)
+	return sb.String()
+}
+
+// termState is the colors a terminal has set. A color is only known after
+// it has been set since the last reset.
+type termState struct {
+	fg, bg           RGB
+	fgKnown, bgKnown bool
+}
+
+// ansiEncoder writes block rows as ANSI text while tracking the terminal
+// state.
+type ansiEncoder struct {
+	r              *Renderer
+	state          termState
+	pendingNewline bool
+	fgCodes        map[RGB]paletteCode
+	bgCodes        map[RGB]paletteCode
+}
+
+// newANSIEncoder returns an encoder for the Renderer's palette, starting
+// from a reset terminal.
+func newANSIEncoder(r *Renderer) *ansiEncoder {
+	return &ansiEncoder{
+		r:       r,
+		fgCodes: make(map[RGB]paletteCode),
+		bgCodes: make(map[RGB]paletteCode),
+	}
+}
+
+// paletteCode is a color's ANSI code and whether it comes from the
+// palette rather than being a 24-bit fallback.
+type paletteCode struct {
+	code      string
+	inPalette bool
+}
+
+// lookupCode returns the palette code for c from om, caching it, or a
+// 24-bit code with the given prefix if the palette lacks c. The boolean
+// reports whether c is in the palette.
+func lookupCode(om *OrderedMap, cache map[RGB]paletteCode, c RGB, prefix string) (string, bool) {
+	if pc, ok := cache[c]; ok {
+		return pc.code, pc.inPalette
+	}
+	pc := paletteCode{code: fmt.Sprintf("%s%d;%d;%d", prefix, c.R, c.G, c.B)}
+	if om != nil {
+		if v, ok := om.Get(c.toUint32()); ok {
+			pc = paletteCode{code: v.(string), inPalette: true}
 		}
 	}
-	if bg != "" {
-		code.WriteString(bg)
-	}
-	code.WriteByte('m')
-	code.WriteString(strings.Repeat(block, count))
-	return code.String()
-}
-
-// extractColors extracts the foreground and background color codes from
-// an ANSI color code. The function takes an ANSI color code as a string
-// and returns the foreground and background color codes as strings.
-func extractColors(colorCodes string) (fg string, bg string) {
-	colors := strings.Split(colorCodes, ";")
-	for i := 0; i < len(colors); i++ {
-		if colors[i] == "38" && i+2 < len(colors) && colors[i+1] == "5" {
-			fg = fmt.Sprintf("38;5;%s", colors[i+2])
-			i += 2
-		} else if colors[i] == "48" && i+2 < len(colors) && colors[i+1] == "5" {
-			bg = fmt.Sprintf("48;5;%s", colors[i+2])
-			i += 2
-		} else if colorIsForeground(colors[i]) {
-			fg = colors[i]
-		} else if colorIsBackground(colors[i]) {
-			bg = colors[i]
+	cache[c] = pc
+	return pc.code, pc.inPalette
+}
+
+// fgCode returns the foreground code for c, and whether c is in the
+// foreground palette.
+func (e *ansiEncoder) fgCode(c RGB) (string, bool) {
+	return lookupCode(e.r.fgAnsi, e.fgCodes, c, "38;2;")
+}
+
+// bgCode returns the background code for c, and whether c is in the
+// background palette.
+func (e *ansiEncoder) bgCode(c RGB) (string, bool) {
+	return lookupCode(e.r.bgAnsi, e.bgCodes, c, "48;2;")
+}
+
+// transition returns the foreground and background codes that must be
+// set to draw o from state s, empty if unchanged, and the state after.
+func (e *ansiEncoder) transition(s termState, o cellOption) (string, string, termState) {
+	var fg, bg string
+	if o.needFG && (!s.fgKnown || s.fg != o.fg) {
+		fg, _ = e.fgCode(o.fg)
+		s.fg, s.fgKnown = o.fg, true
+	}
+	if o.needBG && (!s.bgKnown || s.bg != o.bg) {
+		bg, _ = e.bgCode(o.bg)
+		s.bg, s.bgKnown = o.bg, true
+	}
+	return fg, bg, s
+}
+
+// sgrLength returns the length of the escape sequence setting fg and bg.
+func sgrLength(fg, bg string) int {
+	switch {
+	case fg != "" && bg != "":
+		return len(ESC) + len(fg) + len(bg) + 3
+	case fg != "" || bg != "":
+		return len(ESC) + len(fg) + len(bg) + 2
+	}
+	return 0
+}
+
+// writeRow writes one row of cells followed by the line ending. Without
+// LineReset the newline is held back until the next row or the end of the
+// image, so the final reset comes before it.
+func (e *ansiEncoder) writeRow(sb *strings.Builder, row []BlockRune) {
+	if e.pendingNewline {
+		sb.WriteByte('\n')
+		e.pendingNewline = false
+	}
+	for _, o := range e.planRow(e.state, row) {
+		fg, bg, next := e.transition(e.state, o)
+		if fg != "" || bg != "" {
+			sb.WriteString(ESC + "[")
+			sb.WriteString(fg)
+			if fg != "" && bg != "" {
+				sb.WriteByte(';')
+			}
+			sb.WriteString(bg)
+			sb.WriteByte('m')
 		}
+		sb.WriteRune(o.ch)
+		e.state = next
+	}
+	if e.r.LineReset {
+		sb.WriteString(ESC + "[0m\n")
+		e.state = termState{}
+	} else {
+		e.pendingNewline = true
+	}
+}
+
+// finish resets the terminal after the last row if LineReset is off.
+func (e *ansiEncoder) finish(sb *strings.Builder) {
+	if e.pendingNewline {
+		sb.WriteString(ESC + "[0m\n")
+		e.pendingNewline = false
+		e.state = termState{}
 	}
-	return fg, bg
 }
 
 // colorIsForeground returns true if the ANSI color code corresponds to a
@@ -0,0 +1,90 @@
+package img2ansi
+
+import (
+	"testing"
+)
+
+func TestCompressBlocks(t *testing.T) {
+	t.Parallel()
+
+	red, black, blue := RGB{0xAA, 0, 0}, RGB{0, 0, 0}, RGB{0, 0, 0xAA}
+	white := RGB{0xFF, 0xFF, 0xFF}
+	blocks := [][]BlockRune{
+		{
+			{'▀', red, black},
+			{'▀', red, black},  // unchanged, no sequence
+			{'▄', red, blue},   // background only
+			{' ', white, blue}, // background already blue
+			{'█', red, white},  // foreground already red
+			{' ', white, black},
+		},
+		{
+			{'▀', RGB{1, 2, 3}, black}, // not in the palette
+		},
+	}
+
+	r := NewRenderer(WithPalette("ansi16"))
+	expected := ESC + "[31;40m▀▀" + ESC + "[44m▄ █" + ESC + "[40m " + ESC + "[0m\n" +
+		ESC + "[38;2;1;2;3;40m▀" + ESC + "[0m\n"
+	if got := r.CompressBlocks(blocks); got != expected {
+		t.Errorf("Unexpected output:\n got %q\nwant %q", got, expected)
+	}
+
+	// Without line resets the colors carry over to the next line
+	r = NewRenderer(WithPalette("ansi16"), WithLineReset(false))
+	expected = ESC + "[31;40m▀▀" + ESC + "[44m▄ █" + ESC + "[40m \n" +
+		ESC + "[38;2;1;2;3m▀" + ESC + "[0m\n"
+	if got := r.CompressBlocks(blocks); got != expected {
+		t.Errorf("Unexpected output without line reset:\n got %q\nwant %q", got, expected)
+	}
+}
+
+func TestCompressANSI(t *testing.T) {
+	t.Parallel()
+
+	r := NewRenderer(WithPalette("ansi16"))
+	red, black, blue := RGB{0xAA, 0, 0}, RGB{0, 0, 0}, RGB{0, 0, 0xAA}
+	blocks := [][]BlockRune{
+		{{'▀', red, black}, {'▀', red, black}, {'▄', red, blue}, {' ', red, blue}},
+		{{'▌', blue, red}, {'█', blue, black}, {'▐', red, blue}, {' ', red, black}},
+	}
+
+	raw := r.RenderToAnsi(blocks)
+	compressed := r.CompressANSI(raw)
+	if compressed != r.CompressBlocks(blocks) {
+		t.Errorf("Expected CompressANSI to match CompressBlocks, got %q", compressed)
+	}
+	if len(compressed) >= len(raw) {
+		t.Errorf("Compressed output is %d bytes, raw is %d", len(compressed), len(raw))
+	}
+}
+
+func TestCompressANSIKeepsCodes(t *testing.T) {
+	t.Parallel()
+
+	// The 256-color palette has no code 31, which must be kept as is
+	r := NewRenderer(WithPalette("ansi256"))
+	raw := ESC + "[31;40m▀" + ESC + "[31;40m▀" + ESC + "[31;41m " +
+		ESC + "[38;5;17;49m▄" + ESC + "[0m\n"
+	// Drawn as their complements, the half blocks leave the background red
+	// for the space
+	expected := ESC + "[30;41m▄▄ " + ESC + "[38;5;17;49m▄" + ESC + "[0m\n"
+	if got := r.CompressANSI(raw); got != expected {
+		t.Errorf("Unexpected output:\n got %q\nwant %q", got, expected)
+	}
+
+	// Text the cells can't reproduce is left alone
+	for _, raw := range []string{
+		ESC + "[31;4;40m▀" + ESC + "[0m\n",      // underline
+		ESC + "[1;31;40m▀" + ESC + "[0m\n",      // bold
+		ESC + "[31;40m▀\t▀" + ESC + "[0m\n",     // tab
+		ESC + "[31;40m▀▀" + ESC + "[0m\r\n",     // CR LF
+		ESC + "[31;40m▀▀" + ESC + "[0m\n\n",     // trailing blank line
+		ESC + "[31;40m\xdf\xdf" + ESC + "[0m\n", // CP437
+		ESC + "[31;40m▀▀" + ESC + "[0m\n\x1a",   // EOF marker
+	} {
+		if got := r.CompressANSI(raw); got != raw {
+			t.Errorf("Expected %q unchanged, got %q", raw, got)
+		}
+	}
+}
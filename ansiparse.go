@@ -0,0 +1,380 @@
+package img2ansi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// UnknownSequence is an escape sequence, or an SGR parameter within one,
+// that ParseANSI skipped because it doesn't affect a block grid or isn't
+// supported.
+type UnknownSequence struct {
+	// Row and Column are the cell position where the sequence appeared.
+	Row, Column int
+	// Sequence is the escape sequence without the leading ESC.
+	Sequence string
+}
+
+// xterm16 are xterm's default values for the 16 basic colors, used for
+// codes the Renderer's palette doesn't define.
+var xterm16 = [16]RGB{
+	{0x00, 0x00, 0x00}, {0x80, 0x00, 0x00}, {0x00, 0x80, 0x00}, {0x80, 0x80, 0x00},
+	{0x00, 0x00, 0x80}, {0x80, 0x00, 0x80}, {0x00, 0x80, 0x80}, {0xC0, 0xC0, 0xC0},
+	{0x80, 0x80, 0x80}, {0xFF, 0x00, 0x00}, {0x00, 0xFF, 0x00}, {0xFF, 0xFF, 0x00},
+	{0x00, 0x00, 0xFF}, {0xFF, 0x00, 0xFF}, {0x00, 0xFF, 0xFF}, {0xFF, 0xFF, 0xFF},
+}
+
+// xtermColor returns xterm's default RGB value for a 256-color index.
+func xtermColor(n int) RGB {
+	switch {
+	case n < 16:
+		return xterm16[n]
+	case n < 232:
+		n -= 16
+		level := func(v int) uint8 {
+			if v == 0 {
+				return 0
+			}
+			return uint8(55 + v*40)
+		}
+		return RGB{level(n / 36), level(n / 6 % 6), level(n % 6)}
+	default:
+		gray := uint8(8 + (n-232)*10)
+		return RGB{gray, gray, gray}
+	}
+}
+
+// cp437Runes maps the bytes of CP437 text that ParseANSI decodes to block
+// drawing characters. Other bytes above 0x7F become U+FFFD.
+var cp437Runes = map[byte]rune{
+	0xB0: '░', 0xB1: '▒', 0xB2: '▓',
+	0xDB: '█', 0xDC: '▄', 0xDD: '▌', 0xDE: '▐', 0xDF: '▀',
+	0xFF: ' ',
+}
+
+// sauceWidth strips a trailing SAUCE record and the EOF marker from data
+// and returns the remaining text with the width recorded in the SAUCE
+// record, or 0 if there is none.
+func sauceWidth(data []byte) ([]byte, int) {
+	width := 0
+	if n := len(data); n >= 128 && bytes.HasPrefix(data[n-128:], []byte("SAUCE00")) {
+		record := data[n-128:]
+		if record[94] == 1 { // Character data
+			width = int(binary.LittleEndian.Uint16(record[96:98]))
+		}
+		data = data[:n-128]
+	}
+	if i := bytes.IndexByte(data, 0x1A); i >= 0 {
+		data = data[:i]
+	}
+	return data, width
+}
+
+// decodeText returns data as runes, decoding it as CP437 if it isn't
+// valid UTF-8.
+func decodeText(data []byte) []rune {
+	if utf8.Valid(data) {
+		return []rune(string(data))
+	}
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		switch {
+		case b < 0x80:
+			runes[i] = rune(b)
+		case cp437Runes[b] != 0:
+			runes[i] = cp437Runes[b]
+		default:
+			runes[i] = utf8.RuneError
+		}
+	}
+	return runes
+}
+
+// sgrState is the graphic rendition state tracked by ParseANSI.
+type sgrState struct {
+	fg, bg      string // canonical ANSI codes, e.g. "31" or "48;5;17"
+	bold, blink bool
+}
+
+// code returns the foreground or background code in effect for s, empty
+// for the default color. Bold brightens basic foreground colors and blink
+// brightens basic background colors, as in DOS ANSI art.
+func (s sgrState) code(fg bool) string {
+	code := s.bg
+	if fg {
+		code = s.fg
+	}
+	if n, err := strconv.Atoi(code); err == nil {
+		if fg && s.bold && n >= 30 && n <= 37 {
+			return strconv.Itoa(n + 60)
+		} else if !fg && s.blink && n >= 40 && n <= 47 {
+			return strconv.Itoa(n + 60)
+		}
+	}
+	return code
+}
+
+// ansiCell is a character cell of parsed ANSI text with the rendition it
+// was drawn in.
+type ansiCell struct {
+	ch    rune
+	state sgrState
+}
+
+// ansiParser holds the state of a parseANSICells run.
+type ansiParser struct {
+	rows    [][]ansiCell
+	row     []ansiCell
+	state   sgrState
+	unknown []UnknownSequence
+	// altered is set when the text had something the cells don't keep,
+	// such as bold, tabs or a SAUCE record.
+	altered bool
+}
+
+// resolveCode returns the RGB value of a foreground or background code,
+// looking it up in the Renderer's palette first and falling back to
+// xterm's default colors.
+func (r *Renderer) resolveCode(code string, fg bool) RGB {
+	rev := r.bgAnsiRev
+	if fg {
+		rev = r.fgAnsiRev
+	}
+	if c, ok := rev[code]; ok {
+		return rgbFromUint32(c)
+	}
+
+	parts := strings.Split(code, ";")
+	nums := make([]int, len(parts))
+	for i, part := range parts {
+		nums[i], _ = strconv.Atoi(part)
+	}
+	switch {
+	case len(nums) == 5:
+		return RGB{uint8(nums[2]), uint8(nums[3]), uint8(nums[4])}
+	case len(nums) == 3:
+		return xtermColor(nums[2])
+	case nums[0] >= 90:
+		return xterm16[nums[0]%10+8]
+	default:
+		return xterm16[nums[0]%10]
+	}
+}
+
+// blockRune returns c with its colors resolved. The default colors are
+// those of codes 37 and 40.
+func (r *Renderer) blockRune(c ansiCell) BlockRune {
+	fg, bg := c.state.code(true), c.state.code(false)
+	if fg == "" {
+		fg = "37"
+	}
+	if bg == "" {
+		bg = "40"
+	}
+	return BlockRune{
+		Rune: c.ch,
+		FG:   r.resolveCode(fg, true),
+		BG:   r.resolveCode(bg, false),
+	}
+}
+
+// sgr applies the parameters of an SGR sequence and reports parameters it
+// doesn't handle. An unknown parameter is skipped and the ones after it
+// still apply.
+func (p *ansiParser) sgr(params string) {
+	fields := strings.Split(params, ";")
+	for i := 0; i < len(fields); i++ {
+		n, err := strconv.Atoi(fields[i])
+		if fields[i] == "" {
+			n, err = 0, nil
+		}
+		switch {
+		case err != nil:
+			p.report("[" + fields[i] + "m")
+		case n == 0:
+			p.state = sgrState{}
+		case n == 1:
+			p.state.bold, p.altered = true, true
+		case n == 22:
+			p.state.bold, p.altered = false, true
+		case n == 5:
+			p.state.blink, p.altered = true, true
+		case n == 25:
+			p.state.blink, p.altered = false, true
+		case (n >= 30 && n <= 37) || (n >= 90 && n <= 97):
+			p.state.fg = fields[i]
+		case (n >= 40 && n <= 47) || (n >= 100 && n <= 107):
+			p.state.bg = fields[i]
+		case n == 39:
+			p.state.fg = ""
+		case n == 49:
+			p.state.bg = ""
+		case (n == 38 || n == 48) && i+2 < len(fields) && fields[i+1] == "5":
+			p.extendedColor(fields[i : i+3])
+			i += 2
+		case (n == 38 || n == 48) && i+4 < len(fields) && fields[i+1] == "2":
+			p.extendedColor(fields[i : i+5])
+			i += 4
+		case n == 38 || n == 48:
+			// The length of an unsupported or truncated extended color
+			// is unknown, so the rest of the sequence are its arguments.
+			p.report("[" + strings.Join(fields[i:], ";") + "m")
+			return
+		default:
+			p.report("[" + fields[i] + "m")
+		}
+	}
+}
+
+// extendedColor sets the 256-color or 24-bit color given by the SGR
+// parameters fields, which start with 38 or 48 and the color mode. A
+// color whose index or channels aren't numbers from 0 to 255 is reported
+// instead.
+func (p *ansiParser) extendedColor(fields []string) {
+	code := fields[0] + ";" + fields[1]
+	for _, field := range fields[2:] {
+		v, err := strconv.Atoi(field)
+		if err != nil || v < 0 || v > 255 {
+			p.report("[" + strings.Join(fields, ";") + "m")
+			return
+		}
+		code += ";" + strconv.Itoa(v)
+	}
+	if fields[0] == "38" {
+		p.state.fg = code
+	} else {
+		p.state.bg = code
+	}
+}
+
+// report records an unknown sequence at the current position.
+func (p *ansiParser) report(seq string) {
+	p.unknown = append(p.unknown, UnknownSequence{
+		Row:      len(p.rows),
+		Column:   len(p.row),
+		Sequence: seq,
+	})
+}
+
+// put adds a character cell to the current row.
+func (p *ansiParser) put(ch rune) {
+	p.row = append(p.row, ansiCell{ch: ch, state: p.state})
+}
+
+// ParseANSI reads ANSI text, such as the output of RenderToAnsi or
+// CompressANSI, back into a block grid. Colors are mapped to RGB through
+// the Renderer's palette, so text is best parsed with the palette it was
+// rendered with; codes the palette lacks, including 24-bit codes, get
+// xterm's default values.
+//
+// Classic .ans files are also accepted: text that isn't valid UTF-8 is
+// decoded as CP437, and a SAUCE record, if present, is removed and its
+// width used to wrap rows that don't end in a newline.
+//
+// Escape sequences that don't set colors, such as cursor movement, and
+// SGR attributes other than bold and blink are skipped and returned as
+// unknown sequences. Rows are padded with spaces to the widest row.
+func (r *Renderer) ParseANSI(data []byte) ([][]BlockRune, []UnknownSequence) {
+	cells, unknown, _ := parseANSICells(data)
+	width := 0
+	for _, row := range cells {
+		width = max(width, len(row))
+	}
+	blank := r.blockRune(ansiCell{ch: ' '})
+	blocks := make([][]BlockRune, len(cells))
+	for y, row := range cells {
+		blocks[y] = make([]BlockRune, width)
+		for x := range blocks[y] {
+			if x < len(row) {
+				blocks[y][x] = r.blockRune(row[x])
+			} else {
+				blocks[y][x] = blank
+			}
+		}
+	}
+	return blocks, unknown
+}
+
+// parseANSICells reads ANSI text into rows of character cells, keeping
+// the SGR codes each cell was drawn with. Rows are not padded. The
+// boolean reports whether writing the cells back, with their codes and
+// a newline after each row, gives text that looks the same: it is false
+// if there were unknown sequences, bold or blink, tabs or carriage
+// returns, trailing blank lines, CP437 text or a SAUCE record.
+func parseANSICells(data []byte) ([][]ansiCell, []UnknownSequence, bool) {
+	size := len(data)
+	data, wrap := sauceWidth(data)
+	p := &ansiParser{altered: len(data) != size || !utf8.Valid(data)}
+	text := decodeText(data)
+
+	newline := func() {
+		p.rows = append(p.rows, p.row)
+		p.row = nil
+	}
+	for i := 0; i < len(text); i++ {
+		ch := text[i]
+		switch {
+		case ch == '\x1b':
+			if i+1 < len(text) && text[i+1] == '[' {
+				// CSI: parameter and intermediate bytes, then a final byte
+				j := i + 2
+				for j < len(text) && (text[j] < 0x40 || text[j] > 0x7E) {
+					j++
+				}
+				if j == len(text) {
+					p.report(string(text[i+1:]))
+					i = j
+					continue
+				}
+				if text[j] == 'm' {
+					p.sgr(string(text[i+2 : j]))
+				} else {
+					p.report(string(text[i+1 : j+1]))
+				}
+				i = j
+			} else if i+1 < len(text) {
+				p.report(string(text[i+1]))
+				i++
+			} else {
+				p.report("")
+			}
+			continue
+		case ch == '\n':
+			newline()
+			continue
+		case ch == '\r':
+			p.altered = true
+			continue
+		case ch == '\t':
+			p.altered = true
+			for {
+				p.put(' ')
+				if len(p.row)%8 == 0 {
+					break
+				}
+			}
+		case ch < 0x20:
+			p.report(string(ch))
+			continue
+		default:
+			if wrap > 0 && len(p.row) == wrap {
+				newline()
+			}
+			p.put(ch)
+		}
+	}
+	if len(p.row) > 0 {
+		newline()
+	}
+
+	// Drop trailing empty rows, such as those left by a final reset
+	for len(p.rows) > 0 && len(p.rows[len(p.rows)-1]) == 0 {
+		p.rows = p.rows[:len(p.rows)-1]
+		p.altered = true
+	}
+	exact := !p.altered && len(p.unknown) == 0
+	return p.rows, p.unknown, exact
+}
@@ -0,0 +1,190 @@
+package img2ansi
+
+import (
+	"bytes"
+	"testing"
+)
+
+// sameLook reports whether two cells look the same: block glyphs are
+// compared by the colors of their quadrants, so a space only shows its
+// background and a glyph with swapped colors matches its complement.
+func sameLook(a, b BlockRune) bool {
+	isBlock := func(c BlockRune) bool {
+		return Blocks[blockIndex(c.Rune)].Rune == c.Rune
+	}
+	if !isBlock(a) || !isBlock(b) {
+		return a == b
+	}
+	qa := subpixelGrid([][]BlockRune{{a}})
+	qb := subpixelGrid([][]BlockRune{{b}})
+	for y := range qa {
+		for x := range qa[y] {
+			if qa[y][x] != qb[y][x] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestParseANSIRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	r := NewRenderer(WithPalette("ansi16"))
+	red, black := RGB{0xAA, 0, 0}, RGB{0, 0, 0}
+	yellow, blue := RGB{0xFF, 0xFF, 0x55}, RGB{0, 0, 0xAA}
+	blocks := [][]BlockRune{
+		{{'▀', red, black}, {'▀', red, black}, {' ', yellow, blue}, {'▟', yellow, red}},
+		{{'█', blue, black}, {'▌', black, yellow}, {' ', red, black}, {'▘', red, blue}},
+	}
+
+	for _, tc := range []struct {
+		name string
+		text string
+	}{
+		{"RenderToAnsi", r.RenderToAnsi(blocks)},
+		{"CompressANSI", r.CompressANSI(r.RenderToAnsi(blocks))},
+	} {
+		parsed, unknown := r.ParseANSI([]byte(tc.text))
+		if len(unknown) != 0 {
+			t.Errorf("%s: unexpected unknown sequences %v", tc.name, unknown)
+		}
+		if len(parsed) != len(blocks) {
+			t.Fatalf("%s: expected %d rows, got %d", tc.name, len(blocks), len(parsed))
+		}
+		for y := range blocks {
+			if len(parsed[y]) != len(blocks[y]) {
+				t.Fatalf("%s: row %d has %d cells, want %d",
+					tc.name, y, len(parsed[y]), len(blocks[y]))
+			}
+			for x := range blocks[y] {
+				if !sameLook(parsed[y][x], blocks[y][x]) {
+					t.Errorf("%s: cell (%d,%d) = %v, want %v",
+						tc.name, x, y, parsed[y][x], blocks[y][x])
+				}
+			}
+		}
+	}
+}
+
+func TestParseANSIFile(t *testing.T) {
+	t.Parallel()
+
+	r := NewRenderer(WithPalette("ansi16"))
+	black, red := RGB{0, 0, 0}, RGB{0xAA, 0, 0}
+	yellow := RGB{0xFF, 0xFF, 0x55}
+	blocks := [][]BlockRune{
+		{{'▀', red, black}, {'▄', black, yellow}},
+		{{' ', red, yellow}, {'█', red, black}},
+	}
+	var buf bytes.Buffer
+	if err := r.EncodeANS(&buf, blocks, SAUCE{}); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	parsed, unknown := r.ParseANSI(buf.Bytes())
+	if len(unknown) != 0 {
+		t.Errorf("Unexpected unknown sequences %v", unknown)
+	}
+	// Without iCE colors the bright backgrounds are drawn as swapped
+	// glyphs or full blocks, which look the same.
+	expected := [][]BlockRune{
+		{{'▀', red, black}, {'▀', yellow, black}},
+		{{'█', yellow, black}, {'█', red, black}},
+	}
+	if len(parsed) != 2 || len(parsed[0]) != 2 || len(parsed[1]) != 2 {
+		t.Fatalf("Expected a 2x2 grid, got %v", parsed)
+	}
+	for y := range expected {
+		for x := range expected[y] {
+			if !sameLook(parsed[y][x], expected[y][x]) {
+				t.Errorf("Cell (%d,%d) = %v, want %v",
+					x, y, parsed[y][x], expected[y][x])
+			}
+		}
+	}
+}
+
+func TestParseANSISequences(t *testing.T) {
+	t.Parallel()
+
+	r := NewRenderer(WithPalette("ansi16"))
+	text := ESC + "[38;2;1;2;3;48;5;196m▀" + // 24-bit and 256-color codes
+		ESC + "[2J" + // clear screen, not a color
+		ESC + "[4m▄" + // underline, unsupported
+		ESC + "[39;49m " + // default colors
+		ESC + "[1;31m▌\n" + // bold brightens red
+		"▐"
+
+	parsed, unknown := r.ParseANSI([]byte(text))
+	if len(parsed) != 2 || len(parsed[0]) != 4 || len(parsed[1]) != 4 {
+		t.Fatalf("Expected 2 rows padded to 4 cells, got %v", parsed)
+	}
+
+	expected := []BlockRune{
+		{'▀', RGB{1, 2, 3}, RGB{0xFF, 0, 0}},
+		{'▄', RGB{1, 2, 3}, RGB{0xFF, 0, 0}},
+		{' ', RGB{0xAA, 0xAA, 0xAA}, RGB{0, 0, 0}},
+		{'▌', RGB{0xFF, 0x55, 0x55}, RGB{0, 0, 0}},
+	}
+	for x, want := range expected {
+		if parsed[0][x] != want {
+			t.Errorf("Cell %d = %v, want %v", x, parsed[0][x], want)
+		}
+	}
+	// Bold and colors are kept across lines, padding uses the defaults
+	if got := parsed[1][0]; got.FG != (RGB{0xFF, 0x55, 0x55}) {
+		t.Errorf("Expected bright red on the next line, got %v", got)
+	}
+	if got := parsed[1][3]; got != (BlockRune{' ', RGB{0xAA, 0xAA, 0xAA}, RGB{0, 0, 0}}) {
+		t.Errorf("Expected default padding, got %v", got)
+	}
+
+	want := []UnknownSequence{{0, 1, "[2J"}, {0, 1, "[4m"}}
+	if len(unknown) != len(want) {
+		t.Fatalf("Expected unknown sequences %v, got %v", want, unknown)
+	}
+	for i := range want {
+		if unknown[i] != want[i] {
+			t.Errorf("Unknown sequence %d = %v, want %v", i, unknown[i], want[i])
+		}
+	}
+}
+
+func TestParseANSIUnknownParameterInSequence(t *testing.T) {
+	t.Parallel()
+
+	r := NewRenderer(WithPalette("ansi16"))
+	parsed, unknown := r.ParseANSI([]byte(ESC + "[0;4;31;44m▀"))
+	if len(parsed) != 1 || len(parsed[0]) != 1 {
+		t.Fatalf("Expected a single cell, got %v", parsed)
+	}
+	want := BlockRune{'▀', RGB{0xAA, 0, 0}, RGB{0, 0, 0xAA}}
+	if parsed[0][0] != want {
+		t.Errorf("Expected parameters after underline to apply, got %v, want %v",
+			parsed[0][0], want)
+	}
+	if len(unknown) != 1 || unknown[0] != (UnknownSequence{0, 0, "[4m"}) {
+		t.Errorf("Expected underline to be reported, got %v", unknown)
+	}
+}
+
+func TestParseANSIColorRange(t *testing.T) {
+	t.Parallel()
+
+	r := NewRenderer(WithPalette("ansi16"))
+	for _, seq := range []string{
+		"[38;5;-1m", "[38;5;256m", "[48;5;m",
+		"[38;2;-1;0;0m", "[48;2;0;256;0m", "[38;2;0;0;1000m",
+	} {
+		// The invalid color is skipped, leaving the red foreground
+		text := ESC + "[31m" + ESC + seq + "X\n"
+		parsed, unknown := r.ParseANSI([]byte(text))
+		if got := parsed[0][0].FG; got != (RGB{0xAA, 0, 0}) {
+			t.Errorf("%q: expected red foreground, got %v", seq, got)
+		}
+		if len(unknown) != 1 || unknown[0].Sequence != seq {
+			t.Errorf("%q: expected it reported, got %v", seq, unknown)
+		}
+	}
+}
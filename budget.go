@@ -0,0 +1,218 @@
+package img2ansi
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"unicode/utf8"
+
+	"github.com/wbrown/img2ansi/imageutil"
+)
+
+const (
+	// maxRateLambda is the most block error RenderToBudget trades for a
+	// byte of output before it makes the image narrower instead, unless
+	// the Renderer's RateLambda is larger.
+	maxRateLambda = 64.0
+	// rateLambdaSteps is how many times RenderToBudget halves the range
+	// of RateLambda values it searches.
+	rateLambdaSteps = 6
+	// minBudgetWidth is the narrowest image RenderToBudget renders.
+	minBudgetWidth = 10
+)
+
+// rateChooser returns a blockChooser that minimizes the block error plus
+// lambda times the bytes needed to draw the block after the previous one.
+// Besides the block FindBestBlockRepresentation picks, it tries every
+// glyph in the colors the terminal already has, and in one of them with
+// a palette color close to one of the block's pixels, so that lambda
+// decides when reusing colors is worth the extra error.
+func (r *Renderer) rateChooser(lambda float64) blockChooser {
+	e := newANSIEncoder(r)
+	return func(bx, _ int, block [4]RGB, isEdge bool) (rune, RGB, RGB) {
+		if bx == 0 && r.LineReset {
+			e.state = termState{}
+		}
+
+		bestRune, bestFG, bestBG := r.FindBestBlockRepresentation(block, isEdge)
+		best := BlockRune{bestRune, bestFG, bestBG}
+		bestCost, bestNext := e.rateCost(best, lambda,
+			r.calculateBlockError(block, getQuadrantsForRune(bestRune),
+				bestFG, bestBG, isEdge))
+
+		try := func(fg, bg RGB) {
+			for _, b := range Blocks {
+				d := r.calculateBlockError(block, b.Quad, fg, bg, isEdge)
+				if d >= bestCost {
+					continue
+				}
+				candidate := BlockRune{b.Rune, fg, bg}
+				if cost, next := e.rateCost(candidate, lambda, d); cost < bestCost {
+					best, bestCost, bestNext = candidate, cost, next
+				}
+			}
+		}
+		s := e.state
+		fgAnchors, bgAnchors := r.closestPaletteColors(block)
+		if s.fgKnown && s.bgKnown {
+			try(s.fg, s.bg)
+		}
+		for i := range block {
+			if s.fgKnown {
+				try(s.fg, bgAnchors[i])
+			}
+			if s.bgKnown {
+				try(fgAnchors[i], s.bg)
+			}
+		}
+
+		e.state = bestNext
+		return best.Rune, best.FG, best.BG
+	}
+}
+
+// rateCost returns the cost of drawing block from the encoder's state,
+// given its error, and the state it leaves the terminal in. The block is
+// drawn whichever equivalent way needs the fewest bytes.
+func (e *ansiEncoder) rateCost(block BlockRune, lambda, distortion float64) (float64, termState) {
+	bytes, next := math.MaxInt, e.state
+	for _, o := range e.options(block) {
+		fg, bg, s := e.transition(e.state, o)
+		if n := sgrLength(fg, bg) + utf8.RuneLen(o.ch); n < bytes {
+			bytes, next = n, s
+		}
+	}
+	return distortion + lambda*float64(bytes), next
+}
+
+// BudgetFit is an image fitted into a byte budget by RenderToBudget.
+type BudgetFit struct {
+	Blocks  [][]BlockRune
+	ANSI    string  // Blocks compressed with CompressBlocks
+	Width   int     // width in characters
+	Lambda  float64 // RateLambda the blocks were chosen with
+	Resized *imageutil.RGBAImage
+	Edges   *imageutil.GrayImage
+}
+
+// RenderToBudget renders img at the largest size, up to the one GridSize
+// gives, whose compressed ANSI output is at most budget bytes. Detail is given up
+// before width: at each width, blocks are chosen with a rate-distortion
+// cost, as with RateLambda, and the smallest lambda that fits is found by
+// bisection. The Renderer's RateLambda is the smallest lambda tried. Only
+// when even the largest lambda doesn't fit is the image made smaller,
+// keeping its aspect ratio, by bisection on the width.
+func (r *Renderer) RenderToBudget(img *imageutil.RGBAImage, budget int) (*BudgetFit, error) {
+	return r.RenderToBudgetContext(context.Background(), img, budget)
+}
+
+// RenderToBudgetContext is RenderToBudget with cancellation. It checks ctx
+// before each attempt and after each row of blocks, and returns the
+// context's error once it is done.
+func (r *Renderer) RenderToBudgetContext(
+	ctx context.Context,
+	img *imageutil.RGBAImage,
+	budget int,
+) (*BudgetFit, error) {
+	monitor := r.newRenderMonitor(ctx)
+	fullWidth, fullHeight, shown := r.layout(img.Bounds())
+	if shown != img.Bounds() {
+		img = imageutil.Crop(img, shown)
+	}
+	r.adaptPalette(img)
+	type renderFunc func(lambda float64) (*BudgetFit, error)
+	prepare := func(width int) (renderFunc, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		height := fullHeight
+		if width != fullWidth {
+			height = max(1, int(math.Round(
+				float64(width)*float64(fullHeight)/float64(fullWidth))))
+		}
+		resized, edges := imageutil.PrepareForANSI(img, width, height)
+		return func(lambda float64) (*BudgetFit, error) {
+			blocks, err := r.ditherBlockRows(resized.Clone(), edges,
+				r.chooser(lambda), monitor.nextPass(resized.Height()/2))
+			if err != nil {
+				return nil, err
+			}
+			return &BudgetFit{
+				Blocks:  blocks,
+				ANSI:    r.CompressBlocks(blocks),
+				Width:   width,
+				Lambda:  lambda,
+				Resized: resized,
+				Edges:   edges,
+			}, nil
+		}, nil
+	}
+	fits := func(f *BudgetFit) bool { return len(f.ANSI) <= budget }
+	minLambda := r.RateLambda
+	maxLambda := max(maxRateLambda, minLambda)
+	tooLarge := fmt.Errorf("image too large to fit within %d bytes", budget)
+
+	width := fullWidth
+	render, err := prepare(width)
+	if err != nil {
+		return nil, err
+	}
+	fit, err := render(minLambda)
+	if err != nil || fits(fit) {
+		return fit, err
+	}
+	if fit, err = render(maxLambda); err != nil {
+		return nil, err
+	}
+	if !fits(fit) {
+		if width <= minBudgetWidth {
+			return nil, tooLarge
+		}
+		// Find the widest image that fits at the largest lambda
+		lo, hi := minBudgetWidth, width
+		if render, err = prepare(lo); err != nil {
+			return nil, err
+		}
+		if fit, err = render(maxLambda); err != nil {
+			return nil, err
+		} else if !fits(fit) {
+			return nil, tooLarge
+		}
+		for hi-lo > 1 {
+			mid := (lo + hi) / 2
+			midRender, err := prepare(mid)
+			if err != nil {
+				return nil, err
+			}
+			midFit, err := midRender(maxLambda)
+			if err != nil {
+				return nil, err
+			}
+			if fits(midFit) {
+				lo, render, fit = mid, midRender, midFit
+			} else {
+				hi = mid
+			}
+		}
+		smallest, err := render(minLambda)
+		if err != nil || fits(smallest) {
+			return smallest, err
+		}
+	}
+
+	// Find the smallest lambda that fits at this width
+	lo, hi := minLambda, fit.Lambda
+	for i := 0; i < rateLambdaSteps; i++ {
+		mid := (lo + hi) / 2
+		midFit, err := render(mid)
+		if err != nil {
+			return nil, err
+		}
+		if fits(midFit) {
+			hi, fit = mid, midFit
+		} else {
+			lo = mid
+		}
+	}
+	return fit, nil
+}
@@ -0,0 +1,99 @@
+package img2ansi
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/wbrown/img2ansi/imageutil"
+)
+
+// noiseImage returns an image of random colors, which compresses poorly.
+func noiseImage(width, height int) *imageutil.RGBAImage {
+	rng := rand.New(rand.NewSource(1))
+	img := imageutil.NewRGBAImage(width, height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetRGB(x, y, imageutil.RGB{
+				R: uint8(rng.Intn(256)),
+				G: uint8(rng.Intn(256)),
+				B: uint8(rng.Intn(256)),
+			})
+		}
+	}
+	return img
+}
+
+func TestRateLambda(t *testing.T) {
+	t.Parallel()
+
+	img := noiseImage(40, 30)
+	edges := imageutil.NewGrayImage(40, 30)
+	plain := NewRenderer(WithPalette("ansi16"))
+	rated := NewRenderer(WithPalette("ansi16"), WithRateLambda(30))
+
+	full := plain.CompressBlocks(plain.BrownDitherForBlocks(img.Clone(), edges))
+	small := rated.CompressBlocks(rated.BrownDitherForBlocks(img.Clone(), edges))
+	if len(small) >= len(full) {
+		t.Errorf("Expected RateLambda to shrink output, got %d bytes vs %d",
+			len(small), len(full))
+	}
+}
+
+func TestRenderToBudget(t *testing.T) {
+	t.Parallel()
+
+	img := noiseImage(64, 64)
+	r := NewRenderer(WithPalette("ansi16"), WithTargetWidth(24))
+
+	fit, err := r.RenderToBudget(img, 1<<20)
+	if err != nil {
+		t.Fatalf("Failed to fit: %v", err)
+	}
+	if fit.Width != 24 || fit.Lambda != 0 {
+		t.Errorf("Expected full width and no lambda, got width %d lambda %v",
+			fit.Width, fit.Lambda)
+	}
+	if len(fit.Blocks[0]) != 24 {
+		t.Errorf("Expected 24 columns, got %d", len(fit.Blocks[0]))
+	}
+	full := len(fit.ANSI)
+
+	for _, budget := range []int{full * 3 / 4, full / 4} {
+		fit, err := r.RenderToBudget(img, budget)
+		if err != nil {
+			t.Fatalf("Failed to fit %d bytes: %v", budget, err)
+		}
+		if len(fit.ANSI) > budget {
+			t.Errorf("Output of %d bytes exceeds budget %d", len(fit.ANSI), budget)
+		}
+		if fit.ANSI != r.CompressBlocks(fit.Blocks) {
+			t.Error("ANSI doesn't match the compressed blocks")
+		}
+	}
+
+	fit, err = r.RenderToBudget(img, full*3/4)
+	if err != nil {
+		t.Fatalf("Failed to fit: %v", err)
+	}
+	if fit.Width != 24 || fit.Lambda == 0 {
+		t.Errorf("Expected detail to be reduced before width, got width %d lambda %v",
+			fit.Width, fit.Lambda)
+	}
+
+	if _, err := r.RenderToBudget(img, 10); err == nil {
+		t.Error("Expected an error for a budget no image fits")
+	}
+
+	// A configured RateLambda is the least lambda used
+	r.RateLambda = 20
+	for _, budget := range []int{1 << 20, full * 3 / 4} {
+		fit, err := r.RenderToBudget(img, budget)
+		if err != nil {
+			t.Fatalf("Failed to fit %d bytes: %v", budget, err)
+		}
+		if fit.Lambda < r.RateLambda {
+			t.Errorf("Budget %d: expected lambda at least %v, got %v",
+				budget, r.RateLambda, fit.Lambda)
+		}
+	}
+}
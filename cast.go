@@ -0,0 +1,113 @@
+package img2ansi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// CastHeader describes an asciinema v2 recording. Width and Height are the
+// terminal dimensions in characters; CastHeaderForBlocks derives them from
+// a block grid.
+type CastHeader struct {
+	Width     int
+	Height    int
+	Timestamp int64
+	Title     string
+	Env       map[string]string
+}
+
+// CastHeaderForBlocks returns a header sized for frames rendered from
+// blocks. The height has one extra row so the newline after the last block
+// row doesn't scroll the frame.
+func CastHeaderForBlocks(blocks [][]BlockRune) CastHeader {
+	width := 0
+	if len(blocks) > 0 {
+		width = len(blocks[0])
+	}
+	return CastHeader{
+		Width:     width,
+		Height:    len(blocks) + 1,
+		Timestamp: time.Now().Unix(),
+		Env:       map[string]string{"TERM": "xterm-256color"},
+	}
+}
+
+// CastWriter writes rendered ANSI frames as an asciinema v2 (.cast) file:
+// a JSON header line followed by one JSON event line per frame. Each
+// frame is drawn from the home cursor position, so replaying the file
+// redraws the animation in place.
+type CastWriter struct {
+	w      io.Writer
+	frames int
+	last   time.Duration
+}
+
+// NewCastWriter writes the header and returns a writer for frame events.
+func NewCastWriter(w io.Writer, header CastHeader) (*CastWriter, error) {
+	if header.Width <= 0 || header.Height <= 0 {
+		return nil, fmt.Errorf("invalid cast dimensions %dx%d",
+			header.Width, header.Height)
+	}
+	h := struct {
+		Version   int               `json:"version"`
+		Width     int               `json:"width"`
+		Height    int               `json:"height"`
+		Timestamp int64             `json:"timestamp,omitempty"`
+		Title     string            `json:"title,omitempty"`
+		Env       map[string]string `json:"env,omitempty"`
+	}{2, header.Width, header.Height, header.Timestamp, header.Title, header.Env}
+
+	data, err := json.Marshal(h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode cast header: %v", err)
+	}
+	if _, err := fmt.Fprintf(w, "%s\n", data); err != nil {
+		return nil, err
+	}
+	return &CastWriter{w: w}, nil
+}
+
+// WriteFrame records ansi as a frame shown at the given offset from the
+// start of the recording. The first frame also clears the screen and
+// hides the cursor. Line endings are written as CR LF, as a terminal
+// emits them, since players replay the events as raw terminal output.
+// Offsets must not decrease.
+func (c *CastWriter) WriteFrame(at time.Duration, ansi string) error {
+	if at < c.last {
+		return fmt.Errorf("cast frame at %v is before previous frame at %v",
+			at, c.last)
+	}
+	prefix := ESC + "[H"
+	if c.frames == 0 {
+		prefix = ESC + "[?25l" + ESC + "[2J" + prefix
+	}
+	ansi = strings.ReplaceAll(strings.ReplaceAll(ansi, "\r\n", "\n"), "\n", "\r\n")
+	if err := c.writeEvent(at, prefix+ansi); err != nil {
+		return err
+	}
+	c.frames++
+	c.last = at
+	return nil
+}
+
+// Close records a final event that restores the cursor at the given
+// offset, which also sets the duration of the last frame.
+func (c *CastWriter) Close(at time.Duration) error {
+	if at < c.last {
+		at = c.last
+	}
+	return c.writeEvent(at, ESC+"[?25h")
+}
+
+// writeEvent writes a single output ("o") event line.
+func (c *CastWriter) writeEvent(at time.Duration, data string) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode cast event: %v", err)
+	}
+	_, err = fmt.Fprintf(c.w, "[%.6f, \"o\", %s]\n", at.Seconds(), payload)
+	return err
+}
@@ -0,0 +1,66 @@
+package img2ansi
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCastWriter(t *testing.T) {
+	t.Parallel()
+
+	blocks := [][]BlockRune{
+		{{'▀', RGB{255, 0, 0}, RGB{0, 0, 0}}, {' ', RGB{}, RGB{0, 0, 255}}},
+		{{'█', RGB{0, 255, 0}, RGB{}}, {'▚', RGB{255, 255, 255}, RGB{}}},
+	}
+	header := CastHeaderForBlocks(blocks)
+	header.Title = "test"
+
+	var buf bytes.Buffer
+	cast, err := NewCastWriter(&buf, header)
+	if err != nil {
+		t.Fatalf("Failed to create cast writer: %v", err)
+	}
+	if err := cast.WriteFrame(0, "frame1\n"); err != nil {
+		t.Fatalf("Failed to write frame: %v", err)
+	}
+	if err := cast.WriteFrame(1500*time.Millisecond, "row1\nrow2\r\n"); err != nil {
+		t.Fatalf("Failed to write frame: %v", err)
+	}
+	if err := cast.WriteFrame(time.Second, "late"); err == nil {
+		t.Error("Expected error for out-of-order frame")
+	}
+	if err := cast.Close(2 * time.Second); err != nil {
+		t.Fatalf("Failed to close cast: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected header and 3 events, got %d lines", len(lines))
+	}
+
+	var h map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &h); err != nil {
+		t.Fatalf("Header is not valid JSON: %v", err)
+	}
+	if h["version"] != 2.0 || h["width"] != 2.0 || h["height"] != 3.0 {
+		t.Errorf("Unexpected header: %v", h)
+	}
+
+	var event []interface{}
+	if err := json.Unmarshal([]byte(lines[2]), &event); err != nil {
+		t.Fatalf("Event is not valid JSON: %v", err)
+	}
+	// Rows end in CR LF, so each one starts back at the left edge
+	if event[0] != 1.5 || event[1] != "o" || event[2] != ESC+"[Hrow1\r\nrow2\r\n" {
+		t.Errorf("Unexpected event: %q", event)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &event); err != nil {
+		t.Fatalf("Event is not valid JSON: %v", err)
+	}
+	if !strings.HasPrefix(event[2].(string), ESC+"[?25l"+ESC+"[2J") {
+		t.Errorf("First frame should clear the screen, got %q", event[2])
+	}
+}
@@ -1,10 +1,16 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"github.com/wbrown/img2ansi"
+	"github.com/wbrown/img2ansi/imageutil"
+	"image"
+	"io"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
 	"time"
 )
@@ -43,19 +49,58 @@ import (
 //}
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "remap" {
+		if err := runRemap(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	inputFile := flag.String("input", "",
-		"Path to the input image file (required)")
+		"Path to the input image file, or - for a video frame stream on stdin (required)")
 	outputFile := flag.String("output", "",
-		"Path to save the output (if not specified, prints to stdout)")
+		"Path to save the output (if not specified, prints to stdout); "+
+			".html, .svg, .png, .ans, .irc and .six select those formats")
 	paletteFile := flag.String("palette", "ansi16",
-		"Path to the palette file "+
-			"(Embedded: ansi16, ansi256, jetbrains32)")
+		"Path to the palette file or a terminal color scheme "+
+			"(Embedded: ansi16, ansi256, jetbrains32, mirc16, mirc99, "+
+			"campbell, dracula, gruvbox-dark, gruvbox-light, macos-terminal, "+
+			"nord, solarized-dark, solarized-light, tango, vga, xterm; "+
+			"auto or auto256 read the terminal's colors)")
 	targetWidth := flag.Int("width", 80,
-		"Target width of the output image")
+		"Target width of the output image (defaults to the terminal's when printing to it)")
+	targetHeight := flag.Int("height", 0,
+		"Target height of the output image in lines")
+	sizing := flag.String("sizing", "",
+		"How -width and -height size the output: width, height, fit or fill "+
+			"(default picked from the flags given)")
+	adaptive := flag.Int("adaptive", 0,
+		"Render with a palette of this many colors derived from the image, "+
+			"as 24-bit color codes (overrides -palette)")
+	adaptiveMethod := flag.String("adaptive-method", "kmeans",
+		"How -adaptive derives the palette: kmeans, median-cut or octree")
 	scaleFactor := flag.Float64("scale", 2.0,
 		"Scale factor for the output image")
+	cellSize := flag.String("cell-size", "",
+		"Terminal cell size in pixels WxH, e.g. 9x19 (overrides -scale)")
+	queryCell := flag.Bool("query-cell", false,
+		"Ask the terminal for its cell size (falls back to -scale)")
+	crop := flag.String("crop", "",
+		"Render only this part of the input, x,y,w,h in pixels")
+	zoom := flag.Float64("zoom", 1,
+		"Zoom in on the focus point by this factor")
+	focus := flag.String("focus", "0.5,0.5",
+		"Point to zoom in on, x,y as fractions of the (cropped) image")
 	maxChars := flag.Int("maxchars", 1048576,
-		"Maximum number of characters in the output")
+		"Maximum bytes of compressed ANSI file output")
+	budget := flag.Int("budget", 0,
+		"Fit ANSI output into this many bytes, giving up detail before width "+
+			"(overrides -maxchars)")
+	debugDir := flag.String("debug-dir", "",
+		"Directory to write the resized, edges, dithered and error images to")
+	showProgress := flag.Bool("progress", false,
+		"Show a progress bar on stderr while rendering")
 	_ = flag.Int("quantization", 256,
 		"Quantization factor (deprecated in v1.0.0)")
 	kdSearchDepth := flag.Int("kdsearch", 0,
@@ -64,6 +109,40 @@ func main() {
 		"Max error for approximate cache matches (higher=faster, lower=better quality)")
 	colorMethod := flag.String("colormethod",
 		"RGB", "Color distance method: RGB, LAB, or Redmean")
+	streamFormat := flag.String("format", "auto",
+		"Frame stream format for -input -: auto, y4m, or rgb24")
+	streamSize := flag.String("size", "",
+		"Frame size WxH of an rgb24 frame stream")
+	streamFPS := flag.Float64("fps", 25,
+		"Frame rate of an rgb24 frame stream")
+	castFile := flag.String("cast", "",
+		"Record the rendered image, GIF animation or frame stream as an asciinema v2 .cast file")
+	htmlFont := flag.String("font", "",
+		"CSS font-family for HTML output")
+	htmlLineHeight := flag.Float64("line-height", 1.0,
+		"CSS line-height for HTML output")
+	htmlQuadrants := flag.Bool("html-css", false,
+		"Draw HTML cells with CSS gradients instead of block characters")
+	lineGap := flag.Int("linegap", 0,
+		"Pixels between rows in PNG output")
+	sauceTitle := flag.String("title", "",
+		"SAUCE title for .ans output")
+	sauceAuthor := flag.String("author", "",
+		"SAUCE author for .ans output")
+	sauceGroup := flag.String("group", "",
+		"SAUCE group for .ans output")
+	iceColors := flag.Bool("ice", false,
+		"Use iCE colors (16 background colors) in .ans output")
+	ircColors := flag.Int("irc-colors", 16,
+		"Number of mIRC colors in .irc output: 16 or 99")
+	ircMaxLine := flag.Int("irc-max-line", 400,
+		"Maximum line length in bytes of .irc output")
+	ircSplit := flag.Bool("irc-split", false,
+		"Split .irc rows over the line limit instead of failing")
+	sixel := flag.Bool("sixel", false,
+		"Print the image as Sixel graphics instead of block characters")
+	sixelDither := flag.Bool("sixel-dither", true,
+		"Dither Sixel output to the palette")
 	//printTable := flag.Bool("table", false,
 	//	"Print ANSI color table")
 	// Parse flags
@@ -81,6 +160,63 @@ func main() {
 	//	return
 	//}
 
+	if *budget > 0 {
+		*maxChars = *budget
+	}
+
+	// Find the cell size, which sets the cell aspect ratio if known
+	cellWidth, cellHeight := 0, 0
+	if *cellSize != "" {
+		w, h, err := parseSize(*cellSize)
+		if err != nil || w <= 0 || h <= 0 {
+			fmt.Printf("Invalid cell size %q\n", *cellSize)
+			os.Exit(1)
+		}
+		cellWidth, cellHeight = w, h
+	} else if *queryCell {
+		cellWidth, cellHeight, _ = queryCellSize(200 * time.Millisecond)
+	}
+
+	// Pick the part of the input to render
+	var cropRect image.Rectangle
+	if *crop != "" {
+		rect, err := parseCrop(*crop)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		cropRect = rect
+	}
+	focusX, focusY, err := parseFocus(*focus)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	// Size the output, fitting it to the terminal unless told otherwise
+	widthSet, heightSet := false, false
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "width":
+			widthSet = true
+		case "height":
+			heightSet = true
+		}
+	})
+	sizeMode, err := parseSizeMode(*sizing, widthSet, heightSet)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if !widthSet && !heightSet && *outputFile == "" && *castFile == "" {
+		if cols, rows, ok := fitTerminal(); ok {
+			*targetWidth, *targetHeight = cols, rows
+			if *sizing == "" {
+				sizeMode = img2ansi.SizeFit
+			}
+		}
+	}
+
 	// Build Renderer options
 	*colorMethod = strings.ToLower(*colorMethod)
 	var method img2ansi.ColorDistanceMethod
@@ -96,22 +232,64 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Create Renderer
-	startInit := time.Now()
-	r := img2ansi.NewRenderer(
+	quantizeMethod, err := parseQuantizeMethod(*adaptiveMethod)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	// Use the terminal's own colors for -palette auto, if it tells them
+	paletteOpt := img2ansi.WithPalette(*paletteFile)
+	if auto, ok := autoPalettes[strings.ToLower(*paletteFile)]; ok {
+		fgData, bgData, err := terminalPalette(auto.colors)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Can't read the terminal's colors (%v), using %s\n",
+				err, auto.fallback)
+			paletteOpt = img2ansi.WithPalette(auto.fallback)
+		} else {
+			paletteOpt = img2ansi.WithPaletteData(*paletteFile, fgData, bgData)
+		}
+	}
+
+	opts := []img2ansi.RendererOption{
 		img2ansi.WithTargetWidth(*targetWidth),
+		img2ansi.WithTargetHeight(*targetHeight),
+		img2ansi.WithSizeMode(sizeMode),
 		img2ansi.WithScaleFactor(*scaleFactor),
+		img2ansi.WithCellSize(cellWidth, cellHeight),
+		img2ansi.WithCrop(cropRect),
+		img2ansi.WithZoom(*zoom),
+		img2ansi.WithFocus(focusX, focusY),
 		img2ansi.WithMaxChars(*maxChars),
 		img2ansi.WithKdSearch(*kdSearchDepth),
 		img2ansi.WithCacheThreshold(*threshold),
 		img2ansi.WithColorMethod(method),
-		img2ansi.WithPalette(*paletteFile),
-	)
+		img2ansi.WithTableCache(tableCacheDir()),
+		paletteOpt,
+		img2ansi.WithAdaptivePalette(*adaptive, quantizeMethod),
+	}
+	if *debugDir != "" {
+		sink, err := img2ansi.NewDirSink(*debugDir)
+		if err != nil {
+			fmt.Printf("Error creating debug directory: %v\n", err)
+			os.Exit(1)
+		}
+		opts = append(opts, img2ansi.WithDebugSink(sink))
+	}
+	bar := &progressBar{w: os.Stderr}
+	if *showProgress {
+		opts = append(opts, img2ansi.WithProgress(bar.update))
+	}
+
+	// Create Renderer
+	startInit := time.Now()
+	r := img2ansi.NewRenderer(opts...)
 	endInit := time.Now()
+	*scaleFactor = r.ScaleFactor
 
-	// Error out if precomputed tables aren't available (would be too slow)
-	if !r.UsingPrecomputedTables() {
-		fmt.Fprintf(os.Stderr, "Error: No precomputed tables for colormethod %q.\n", *colorMethod)
+	// Error out if lookup tables aren't available (would be too slow)
+	if !r.HasLookupTables() {
+		fmt.Fprintf(os.Stderr, "Error: No lookup tables for colormethod %q.\n", *colorMethod)
 		fmt.Fprintf(os.Stderr, "Use -colormethod with one of: RGB, LAB, Redmean\n")
 		os.Exit(1)
 	}
@@ -126,33 +304,205 @@ func main() {
 		return
 	}
 
+	// Record an asciinema cast instead of printing the image
+	if *castFile != "" {
+		var next frameSource
+		if *inputFile == "-" {
+			frames, err := openFrameStream(os.Stdin,
+				*streamFormat, *streamSize, *streamFPS)
+			if err != nil {
+				fmt.Printf("Error opening frame stream: %v\n", err)
+				os.Exit(1)
+			}
+			next = streamSource(frames)
+		} else if strings.HasSuffix(strings.ToLower(*inputFile), ".gif") {
+			anim, err := imageutil.LoadAnimation(*inputFile)
+			if err != nil {
+				fmt.Printf("Error loading animation: %v\n", err)
+				os.Exit(1)
+			}
+			next = animationSource(anim)
+		} else {
+			img, err := imageutil.LoadImage(*inputFile)
+			if err != nil {
+				fmt.Printf("Error loading image: %v\n", err)
+				os.Exit(1)
+			}
+			next = animationSource(&imageutil.Animation{
+				Frames: []*imageutil.RGBAImage{img},
+				Delays: []time.Duration{0},
+			})
+		}
+		title := ""
+		if *inputFile != "-" {
+			title = filepath.Base(*inputFile)
+		}
+		count, err := writeCastFile(*castFile, img2ansi.NewFrameRenderer(r),
+			next, title)
+		if err != nil {
+			fmt.Printf("Error writing cast: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Recorded %d frames to %s\n", count, *castFile)
+		return
+	}
+
+	// Draw the image with Sixel graphics
+	if *sixel || isSixelOutput(*outputFile) {
+		path := ""
+		if isSixelOutput(*outputFile) {
+			path = *outputFile
+		}
+		opts := img2ansi.SixelOptions{
+			CellWidth:   cellWidth,
+			ScaleFactor: *scaleFactor,
+			Dither:      *sixelDither,
+		}
+		if err := writeSixel(r, *inputFile, path, opts); err != nil {
+			fmt.Printf("Error writing Sixel output: %v\n", err)
+			os.Exit(1)
+		}
+		if path != "" {
+			fmt.Printf("Output written to %s\n", path)
+		}
+		return
+	}
+
+	// Write a non-ANSI format selected by the output extension
+	if isEncodedOutput(*outputFile) {
+		blocks, err := renderBlocks(r, *inputFile)
+		bar.clear()
+		if err != nil {
+			fmt.Printf("Error converting image: %v\n", err)
+			os.Exit(1)
+		}
+		opts := outputOptions{
+			html: img2ansi.HTMLOptions{
+				Title:        filepath.Base(*inputFile),
+				FontFamily:   *htmlFont,
+				LineHeight:   *htmlLineHeight,
+				CSSQuadrants: *htmlQuadrants,
+			},
+			svg: img2ansi.SVGOptions{ScaleFactor: *scaleFactor},
+			png: img2ansi.RasterOptions{LineGap: *lineGap},
+			ans: img2ansi.SAUCE{
+				Title:     *sauceTitle,
+				Author:    *sauceAuthor,
+				Group:     *sauceGroup,
+				ICEColors: *iceColors,
+			},
+			irc: img2ansi.IRCOptions{
+				Colors:       *ircColors,
+				MaxLineBytes: *ircMaxLine,
+				SplitLines:   *ircSplit,
+			},
+		}
+		if err := writeEncodedOutput(*outputFile, r, blocks, opts); err != nil {
+			fmt.Printf("Error writing output: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Output written to %s\n", *outputFile)
+		return
+	}
+
+	// Play a frame stream from stdin
+	if *inputFile == "-" {
+		frames, err := openFrameStream(os.Stdin,
+			*streamFormat, *streamSize, *streamFPS)
+		if err != nil {
+			fmt.Printf("Error opening frame stream: %v\n", err)
+			os.Exit(1)
+		}
+		stats, err := playFrames(img2ansi.NewFrameRenderer(r), frames, os.Stdout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading frame stream: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Frames: %d rendered, %d dropped\n",
+			stats.rendered, stats.dropped)
+		return
+	}
+
+	// Stream ANSI art to stdout as rows are rendered, unless the output
+	// might exceed -maxchars and has to be fitted first
+	if *outputFile == "" && *budget == 0 && *debugDir == "" && !*showProgress {
+		resized, edges, err := prepareImage(r, *inputFile)
+		if err != nil {
+			fmt.Printf("Error converting image: %v\n", err)
+			os.Exit(1)
+		}
+		cols, rows := resized.Width()/2, resized.Height()/2
+		if r.MaxANSIBytes(cols, rows) <= *maxChars {
+			out := &countingWriter{w: os.Stdout}
+			if _, err := r.RenderStream(out, resized, edges); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+				os.Exit(1)
+			}
+			printStats(r, time.Since(endInit), out.n)
+			return
+		}
+	}
+
 	// Generate ANSI art
-	ansiArt, err := r.ImageToANSI(*inputFile)
+	img, err := imageutil.LoadImage(*inputFile)
+	if err != nil {
+		fmt.Printf("Error converting image: %v\n", err)
+		os.Exit(1)
+	}
+	// Stop rendering on interrupt
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	result, err := r.RenderImageContext(ctx, img)
+	bar.clear()
 	if err != nil {
 		fmt.Printf("Error converting image: %v\n", err)
 		os.Exit(1)
 	}
-	compressedArt := r.CompressANSI(ansiArt)
+	if result.DebugErr != nil {
+		fmt.Fprintf(os.Stderr, "Error writing debug images: %v\n", result.DebugErr)
+	}
 	endComputation := time.Now()
 
 	// Output result
-	if *outputFile != "" {
-		err := os.WriteFile(*outputFile, []byte(compressedArt), 0644)
-		if err != nil {
+	if *outputFile == "" {
+		fmt.Print(result.ANSI)
+	} else {
+		if err := os.WriteFile(*outputFile, []byte(result.ANSI), 0644); err != nil {
 			fmt.Printf("Error writing to file: %v\n", err)
 			return
 		}
 		fmt.Printf("Output written to %s\n", *outputFile)
-	} else {
-		fmt.Print(compressedArt)
 	}
+	fmt.Printf("Size: %dx%d\n", result.Width, result.Height)
+	if result.Stats.RateLambda > 0 {
+		fmt.Printf("Rate-distortion lambda: %.2f\n", result.Stats.RateLambda)
+	}
+	printStats(r, endComputation.Sub(endInit), len(result.ANSI))
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += n
+	return n, err
+}
 
+// printStats prints timing, output size and cache statistics.
+func printStats(
+	r *img2ansi.Renderer,
+	computation time.Duration,
+	compressedLength int,
+) {
 	hits, misses, hitRate := r.CacheStats()
 	uniqueKeys, sharedKeys, totalBlocks, avgError := r.CacheKeyStats()
-	fmt.Printf("Computation time: %v\n", endComputation.Sub(endInit))
+	fmt.Printf("Computation time: %v\n", computation)
 	fmt.Printf("BestBlock calculation time: %v\n", r.GetBestBlockTime())
-	fmt.Printf("Total string length: %d\n", len(ansiArt))
-	fmt.Printf("Compressed string length: %d\n", len(compressedArt))
+	fmt.Printf("Compressed string length: %d\n", compressedLength)
 	fmt.Printf("Block Cache: %d hits, %d misses (%.1f%% hit rate)\n",
 		hits, misses, hitRate*100)
 	fmt.Printf("Cache Keys: %d unique, %d shared (%d blocks, avg error %.1f)\n",
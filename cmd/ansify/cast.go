@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/wbrown/img2ansi"
+	"github.com/wbrown/img2ansi/imageutil"
+)
+
+// frameSource returns the next frame and the time it is shown at, or
+// io.EOF together with the end time of the recording.
+type frameSource func() (*imageutil.RGBAImage, time.Duration, error)
+
+// streamSource adapts a frame stream to a frameSource, timing frames by
+// the stream's frame rate.
+func streamSource(frames imageutil.FrameReader) frameSource {
+	frameDuration := time.Duration(float64(time.Second) / frames.FrameRate())
+	i := 0
+	return func() (*imageutil.RGBAImage, time.Duration, error) {
+		at := time.Duration(i) * frameDuration
+		frame, err := frames.ReadFrame()
+		if err != nil {
+			return nil, at, err
+		}
+		i++
+		return frame, at, nil
+	}
+}
+
+// animationSource adapts a decoded animation to a frameSource, timing
+// frames by their delays.
+func animationSource(anim *imageutil.Animation) frameSource {
+	i := 0
+	var at time.Duration
+	return func() (*imageutil.RGBAImage, time.Duration, error) {
+		if i >= len(anim.Frames) {
+			return nil, at, io.EOF
+		}
+		frame, start := anim.Frames[i], at
+		at += anim.Delays[i]
+		i++
+		return frame, start, nil
+	}
+}
+
+// recordCast renders every frame from next and writes the result as an
+// asciinema v2 recording. Unlike live playback no frames are dropped,
+// since the recording keeps its own timing.
+func recordCast(
+	fr *img2ansi.FrameRenderer,
+	next frameSource,
+	title string,
+	out io.Writer,
+) (int, error) {
+	r := fr.Renderer()
+	var cast *img2ansi.CastWriter
+	for count := 0; ; count++ {
+		frame, at, err := next()
+		if err == io.EOF {
+			if cast == nil {
+				return 0, fmt.Errorf("no frames to record")
+			}
+			return count, cast.Close(at)
+		}
+		if err != nil {
+			return count, err
+		}
+
+		resized, edges := r.PrepareImage(frame)
+		blocks := fr.RenderFrame(resized, edges)
+
+		if cast == nil {
+			header := img2ansi.CastHeaderForBlocks(blocks)
+			header.Title = title
+			if cast, err = img2ansi.NewCastWriter(out, header); err != nil {
+				return count, err
+			}
+		}
+		if err := cast.WriteFrame(at,
+			r.CompressBlocks(blocks)); err != nil {
+			return count, err
+		}
+	}
+}
+
+// writeCastFile records the frames from next into the file at path.
+func writeCastFile(
+	path string,
+	fr *img2ansi.FrameRenderer,
+	next frameSource,
+	title string,
+) (int, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	count, err := recordCast(fr, next, title, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return count, err
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/wbrown/img2ansi"
+	"github.com/wbrown/img2ansi/imageutil"
+)
+
+// outputOptions holds the format specific flags for encoded outputs.
+type outputOptions struct {
+	html img2ansi.HTMLOptions
+	svg  img2ansi.SVGOptions
+	png  img2ansi.RasterOptions
+	ans  img2ansi.SAUCE
+	irc  img2ansi.IRCOptions
+}
+
+// isEncodedOutput reports whether path has the extension of one of the
+// non-ANSI output encoders.
+func isEncodedOutput(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm", ".svg", ".png", ".ans", ".irc":
+		return true
+	}
+	return false
+}
+
+// isSixelOutput reports whether path has a Sixel file extension.
+func isSixelOutput(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".six", ".sixel":
+		return true
+	}
+	return false
+}
+
+// prepareImage loads the input image and prepares it for a block grid of
+// the Renderer's target size.
+func prepareImage(
+	r *img2ansi.Renderer,
+	inputPath string,
+) (*imageutil.RGBAImage, *imageutil.GrayImage, error) {
+	img, err := imageutil.LoadImage(inputPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	resized, edges := r.PrepareImage(img)
+	return resized, edges, nil
+}
+
+// isANSIInput reports whether path has the extension of ANSI text, such
+// as earlier ansify output or classic .ans art.
+func isANSIInput(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ans", ".ansi", ".txt":
+		return true
+	}
+	return false
+}
+
+// parseBlocks reads an ANSI text file back into a block grid, reporting
+// escape sequences it skipped on stderr.
+func parseBlocks(
+	r *img2ansi.Renderer,
+	inputPath string,
+) ([][]img2ansi.BlockRune, error) {
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	blocks, unknown := r.ParseANSI(data)
+	for _, u := range unknown {
+		fmt.Fprintf(os.Stderr, "Skipped ESC%q at row %d, column %d\n",
+			u.Sequence, u.Row, u.Column)
+	}
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("no text in %s", inputPath)
+	}
+	return blocks, nil
+}
+
+// renderBlocks loads and dithers the input image at the target size. ANSI
+// text inputs are parsed instead, keeping their own size.
+func renderBlocks(
+	r *img2ansi.Renderer,
+	inputPath string,
+) ([][]img2ansi.BlockRune, error) {
+	if isANSIInput(inputPath) {
+		return parseBlocks(r, inputPath)
+	}
+	resized, edges, err := prepareImage(r, inputPath)
+	if err != nil {
+		return nil, err
+	}
+	return r.BrownDitherForBlocks(resized, edges), nil
+}
+
+// writeSixel writes the input image as Sixel graphics to path, or to
+// stdout if path is empty.
+func writeSixel(
+	r *img2ansi.Renderer,
+	inputPath string,
+	path string,
+	opts img2ansi.SixelOptions,
+) error {
+	resized, edges, err := prepareImage(r, inputPath)
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		return r.EncodeSixel(os.Stdout, resized, edges, opts)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = r.EncodeSixel(f, resized, edges, opts)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// writeEncodedOutput writes blocks to path in the format selected by the
+// file extension.
+func writeEncodedOutput(
+	path string,
+	r *img2ansi.Renderer,
+	blocks [][]img2ansi.BlockRune,
+	opts outputOptions,
+) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm":
+		err = img2ansi.EncodeHTML(f, blocks, opts.html)
+	case ".svg":
+		err = img2ansi.EncodeSVG(f, blocks, opts.svg)
+	case ".png":
+		err = img2ansi.EncodePNG(f, blocks, opts.png)
+	case ".ans":
+		err = r.EncodeANS(f, blocks, opts.ans)
+	case ".irc":
+		err = img2ansi.EncodeIRC(f, blocks, opts.irc)
+	default:
+		err = fmt.Errorf("no encoder for %s", path)
+	}
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
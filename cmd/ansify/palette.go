@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/wbrown/img2ansi"
+)
+
+// autoPalette is a -palette value that reads the terminal's own colors.
+type autoPalette struct {
+	// colors is how many colors to ask the terminal for
+	colors int
+	// fallback is the palette used if it doesn't answer
+	fallback string
+}
+
+// autoPalettes are the -palette values that query the terminal.
+var autoPalettes = map[string]autoPalette{
+	"auto":    {colors: 16, fallback: "ansi16"},
+	"auto256": {colors: 256, fallback: "ansi256"},
+}
+
+// terminalPalette asks the terminal for its colors with OSC 4, 10 and 11
+// and returns them as foreground and background palettes.
+func terminalPalette(colors int) (img2ansi.AnsiData, img2ansi.AnsiData, error) {
+	reply, ok := queryColors(colors, 500*time.Millisecond)
+	if !ok {
+		return nil, nil, errors.New("no reply from the terminal")
+	}
+	scheme, err := img2ansi.ParseColorReplies(reply)
+	if err != nil {
+		return nil, nil, err
+	}
+	return scheme.AnsiData(colors)
+}
+
+// tableCacheDir returns the directory the color tables computed for
+// palettes read from the terminal are kept in, or "" if there is none.
+func tableCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "img2ansi", "tables")
+}
+
+// parseQuantizeMethod returns the method named by -adaptive-method.
+func parseQuantizeMethod(name string) (img2ansi.QuantizeMethod, error) {
+	switch strings.ToLower(name) {
+	case "kmeans", "k-means":
+		return img2ansi.QuantizeKMeans, nil
+	case "median-cut", "mediancut":
+		return img2ansi.QuantizeMedianCut, nil
+	case "octree":
+		return img2ansi.QuantizeOctree, nil
+	}
+	return 0, fmt.Errorf("invalid adaptive method %q, options are kmeans, median-cut or octree", name)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/wbrown/img2ansi"
+)
+
+// progressBarWidth is the number of characters in the progress bar.
+const progressBarWidth = 30
+
+// progressBar draws the progress of a render on one line of w, usually
+// stderr, redrawing it in place.
+type progressBar struct {
+	w     io.Writer
+	shown bool
+}
+
+// update redraws the bar for p.
+func (b *progressBar) update(p img2ansi.Progress) {
+	if p.TotalRows == 0 {
+		return
+	}
+	done := progressBarWidth * p.Rows / p.TotalRows
+	fmt.Fprintf(b.w, "\r[%s%s] %3d%% pass %d, cache %.1f%%, %v",
+		strings.Repeat("=", done), strings.Repeat(" ", progressBarWidth-done),
+		100*p.Rows/p.TotalRows, p.Pass, p.CacheHitRate*100,
+		p.Elapsed.Round(100*time.Millisecond))
+	b.shown = true
+}
+
+// clear erases the bar, if it was drawn.
+func (b *progressBar) clear() {
+	if b.shown {
+		fmt.Fprint(b.w, "\r\x1b[K")
+		b.shown = false
+	}
+}
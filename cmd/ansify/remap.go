@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/wbrown/img2ansi"
+)
+
+// runRemap implements "ansify remap", which converts existing ANSI art to
+// another palette without going back to the source image.
+func runRemap(args []string) error {
+	fs := flag.NewFlagSet("remap", flag.ExitOnError)
+	inputFile := fs.String("input", "-",
+		"Path to the ANSI text to remap, or - for stdin")
+	outputFile := fs.String("output", "",
+		"Path to save the output (if not specified, prints to stdout); "+
+			".html, .svg, .png, .ans and .irc select those formats")
+	from := fs.String("from", "ansi256",
+		"Palette the input was rendered with")
+	to := fs.String("to", "ansi16",
+		"Palette to convert to")
+	dither := fs.Bool("dither", false,
+		"Diffuse the color error between cells")
+	colorMethod := fs.String("colormethod", "RGB",
+		"Color distance method: RGB, LAB, or Redmean")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(),
+			"Usage: ansify remap -from <palette> -to <palette> "+
+				"[-input <file>] [-output <file>] [-dither]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var method img2ansi.ColorDistanceMethod
+	switch strings.ToLower(*colorMethod) {
+	case "rgb":
+		method = img2ansi.RGBMethod{}
+	case "lab":
+		method = img2ansi.LABMethod{}
+	case "redmean":
+		method = img2ansi.RedmeanMethod{}
+	default:
+		return fmt.Errorf("invalid color distance method, " +
+			"options are RGB, LAB, or Redmean")
+	}
+
+	var data []byte
+	var err error
+	if *inputFile == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(*inputFile)
+	}
+	if err != nil {
+		return err
+	}
+
+	source := img2ansi.NewRenderer(img2ansi.WithColorMethod(method))
+	if err := source.LoadPalette(*from); err != nil {
+		return fmt.Errorf("loading palette %q: %v", *from, err)
+	}
+	blocks, unknown := source.ParseANSI(data)
+	for _, u := range unknown {
+		fmt.Fprintf(os.Stderr, "Skipped ESC%q at row %d, column %d\n",
+			u.Sequence, u.Row, u.Column)
+	}
+	if len(blocks) == 0 {
+		return fmt.Errorf("no text in input")
+	}
+
+	target := img2ansi.NewRenderer(img2ansi.WithColorMethod(method))
+	if err := target.LoadPalette(*to); err != nil {
+		return fmt.Errorf("loading palette %q: %v", *to, err)
+	}
+	remapped := target.RemapBlocks(blocks, *dither)
+
+	if isEncodedOutput(*outputFile) {
+		return writeEncodedOutput(*outputFile, target, remapped, outputOptions{})
+	}
+	art := target.CompressBlocks(remapped)
+	if *outputFile == "" {
+		_, err = fmt.Print(art)
+		return err
+	}
+	return os.WriteFile(*outputFile, []byte(art), 0644)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/wbrown/img2ansi"
+)
+
+// parseSizeMode returns the sizing mode named by -sizing. An empty name
+// picks one from the size flags given: fit for both -width and -height,
+// height for -height alone and width otherwise.
+func parseSizeMode(name string, widthSet, heightSet bool) (img2ansi.SizeMode, error) {
+	switch strings.ToLower(name) {
+	case "":
+		switch {
+		case widthSet && heightSet:
+			return img2ansi.SizeFit, nil
+		case heightSet:
+			return img2ansi.SizeHeight, nil
+		}
+		return img2ansi.SizeWidth, nil
+	case "width":
+		return img2ansi.SizeWidth, nil
+	case "height":
+		return img2ansi.SizeHeight, nil
+	case "fit":
+		return img2ansi.SizeFit, nil
+	case "fill":
+		return img2ansi.SizeFill, nil
+	}
+	return 0, fmt.Errorf("invalid sizing %q, options are width, height, fit or fill", name)
+}
+
+// fitTerminal returns the size of the terminal on stdout, leaving a line
+// for the prompt, or false if stdout isn't a terminal.
+func fitTerminal() (cols, rows int, ok bool) {
+	cols, rows, ok = terminalSize(os.Stdout)
+	if !ok || rows < 2 {
+		return 0, 0, false
+	}
+	return cols, rows - 1, true
+}
+
+// parseCrop parses a -crop rectangle given as "x,y,w,h" in pixels.
+func parseCrop(crop string) (image.Rectangle, error) {
+	parts := strings.Split(crop, ",")
+	if len(parts) != 4 {
+		return image.Rectangle{}, fmt.Errorf("invalid crop %q, expected x,y,w,h", crop)
+	}
+	var v [4]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < 0 {
+			return image.Rectangle{}, fmt.Errorf("invalid crop %q, expected x,y,w,h", crop)
+		}
+		v[i] = n
+	}
+	if v[2] == 0 || v[3] == 0 {
+		return image.Rectangle{}, fmt.Errorf("crop %q is empty", crop)
+	}
+	return image.Rect(v[0], v[1], v[0]+v[2], v[1]+v[3]), nil
+}
+
+// parseFocus parses a -focus point given as "x,y" fractions of the image's
+// width and height.
+func parseFocus(focus string) (x, y float64, err error) {
+	xs, ys, found := strings.Cut(focus, ",")
+	if !found {
+		return 0, 0, fmt.Errorf("invalid focus %q, expected x,y", focus)
+	}
+	x, errX := strconv.ParseFloat(strings.TrimSpace(xs), 64)
+	y, errY := strconv.ParseFloat(strings.TrimSpace(ys), 64)
+	if errX != nil || errY != nil || x < 0 || x > 1 || y < 0 || y > 1 {
+		return 0, 0, fmt.Errorf("invalid focus %q, expected x,y between 0 and 1", focus)
+	}
+	return x, y, nil
+}
@@ -0,0 +1,25 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// terminalSize always returns false where the terminal size can't be
+// queried.
+func terminalSize(f *os.File) (cols, rows int, ok bool) {
+	return 0, 0, false
+}
+
+// queryCellSize always returns false where the terminal can't be
+// queried.
+func queryCellSize(timeout time.Duration) (width, height int, ok bool) {
+	return 0, 0, false
+}
+
+// queryColors always returns false where the terminal can't be queried.
+func queryColors(colors int, timeout time.Duration) ([]byte, bool) {
+	return nil, false
+}
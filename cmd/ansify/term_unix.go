@@ -0,0 +1,167 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// winsize is the terminal size reported by TIOCGWINSZ.
+type winsize struct {
+	Row, Col       uint16
+	Xpixel, Ypixel uint16
+}
+
+// getWinsize reads the terminal size of f.
+func getWinsize(f *os.File) (winsize, bool) {
+	var ws winsize
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(),
+		uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&ws)))
+	return ws, errno == 0 && ws.Col > 0 && ws.Row > 0
+}
+
+// terminalSize returns the size in cells of the terminal f is connected
+// to, or false if f isn't a terminal.
+func terminalSize(f *os.File) (cols, rows int, ok bool) {
+	ws, ok := getWinsize(f)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(ws.Col), int(ws.Row), true
+}
+
+// ioctl calls the ioctl request on f with the argument at arg.
+func ioctl(f *os.File, request uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), request, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// makeRaw turns off line buffering and echo on the terminal f, so that
+// replies to queries can be read as they arrive without showing up on
+// screen. A read returns after a tenth of a second without input, even
+// if nothing arrived, so a reader can give up on a terminal that doesn't
+// answer. It returns a function restoring the previous settings.
+func makeRaw(f *os.File) (func(), error) {
+	var old syscall.Termios
+	if err := ioctl(f, ioctlGetTermios, unsafe.Pointer(&old)); err != nil {
+		return nil, err
+	}
+	raw := old
+	raw.Lflag &^= syscall.ICANON | syscall.ECHO
+	raw.Cc[syscall.VMIN] = 0
+	raw.Cc[syscall.VTIME] = 1
+	if err := ioctl(f, ioctlSetTermios, unsafe.Pointer(&raw)); err != nil {
+		return nil, err
+	}
+	return func() { ioctl(f, ioctlSetTermios, unsafe.Pointer(&old)) }, nil
+}
+
+var (
+	// cellSizeReply is the reply to CSI 16 t: CSI 6 ; height ; width t.
+	cellSizeReply = regexp.MustCompile(`\x1b\[6;(\d+);(\d+)t`)
+	// textAreaReply is the reply to CSI 14 t: CSI 4 ; height ; width t.
+	textAreaReply = regexp.MustCompile(`\x1b\[4;(\d+);(\d+)t`)
+	// deviceAttrsReply is the reply to CSI c, which every terminal sends.
+	deviceAttrsReply = regexp.MustCompile(`\x1b\[\?[\d;]*c`)
+)
+
+// queryCellSize returns the size of the terminal's cells in pixels. It
+// uses the pixel size the terminal reports with its window size if it
+// has one, and otherwise asks it with CSI 16 t, for the cell size, and
+// CSI 14 t, for the size of the text area, which is divided by the
+// window size. The queries are followed by CSI c, which all terminals
+// answer, so that one supporting neither doesn't make it wait for the
+// whole timeout.
+func queryCellSize(timeout time.Duration) (width, height int, ok bool) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return 0, 0, false
+	}
+	defer tty.Close()
+
+	ws, haveSize := getWinsize(tty)
+	if haveSize && ws.Xpixel > 0 && ws.Ypixel > 0 {
+		return int(ws.Xpixel / ws.Col), int(ws.Ypixel / ws.Row), true
+	}
+
+	reply, ok := queryTTY(tty, "\x1b[16t\x1b[14t", timeout)
+	if !ok {
+		return 0, 0, false
+	}
+
+	if m := cellSizeReply.FindSubmatch(reply); m != nil {
+		h, _ := strconv.Atoi(string(m[1]))
+		w, _ := strconv.Atoi(string(m[2]))
+		if w > 0 && h > 0 {
+			return w, h, true
+		}
+	}
+	if m := textAreaReply.FindSubmatch(reply); m != nil && haveSize {
+		h, _ := strconv.Atoi(string(m[1]))
+		w, _ := strconv.Atoi(string(m[2]))
+		if w >= int(ws.Col) && h >= int(ws.Row) {
+			return w / int(ws.Col), h / int(ws.Row), true
+		}
+	}
+	return 0, 0, false
+}
+
+// queryTTY sends query to the terminal tty followed by CSI c, which all
+// terminals answer, and returns everything it replies up to the answer to
+// that. It returns false if the terminal doesn't answer within timeout.
+func queryTTY(tty *os.File, query string, timeout time.Duration) ([]byte, bool) {
+	restore, err := makeRaw(tty)
+	if err != nil {
+		return nil, false
+	}
+	defer restore()
+	if _, err := tty.WriteString(query + "\x1b[c"); err != nil {
+		return nil, false
+	}
+
+	// Reads return empty when no input arrives for a while, so nothing is
+	// left reading from the terminal once the timeout has passed
+	var reply []byte
+	buf := make([]byte, 4096)
+	deadline := time.Now().Add(timeout)
+	for !deviceAttrsReply.Match(reply) {
+		if time.Now().After(deadline) {
+			return nil, false
+		}
+		n, err := tty.Read(buf)
+		if err != nil && err != io.EOF {
+			return nil, false
+		}
+		reply = append(reply, buf[:n]...)
+	}
+	return reply, true
+}
+
+// queryColors asks the terminal for the first colors of its palette with
+// OSC 4, and for its default foreground and background with OSC 10 and
+// 11, and returns its replies.
+func queryColors(colors int, timeout time.Duration) ([]byte, bool) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, false
+	}
+	defer tty.Close()
+
+	var query strings.Builder
+	for n := 0; n < colors; n++ {
+		fmt.Fprintf(&query, "\x1b]4;%d;?\x07", n)
+	}
+	query.WriteString("\x1b]10;?\x07\x1b]11;?\x07")
+	return queryTTY(tty, query.String(), timeout)
+}
@@ -0,0 +1,9 @@
+package main
+
+import "syscall"
+
+// ioctl requests reading and setting terminal attributes.
+const (
+	ioctlGetTermios = syscall.TCGETS
+	ioctlSetTermios = syscall.TCSETS
+)
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wbrown/img2ansi"
+	"github.com/wbrown/img2ansi/imageutil"
+)
+
+// openFrameStream wraps in with a frame reader for the given format.
+// Format "auto" detects y4m by its signature and otherwise assumes raw
+// RGB24, which requires size ("WxH") and fps.
+func openFrameStream(
+	in io.Reader,
+	format, size string,
+	fps float64,
+) (imageutil.FrameReader, error) {
+	br := bufio.NewReader(in)
+	if format == "auto" {
+		header, _ := br.Peek(len("YUV4MPEG2"))
+		if imageutil.IsY4M(header) {
+			format = "y4m"
+		} else {
+			format = "rgb24"
+		}
+	}
+
+	switch format {
+	case "y4m":
+		return imageutil.NewY4MReader(br)
+	case "rgb24":
+		width, height, err := parseSize(size)
+		if err != nil {
+			return nil, fmt.Errorf("rgb24 input needs -size WxH: %v", err)
+		}
+		return imageutil.NewRawRGBReader(br, width, height, fps)
+	default:
+		return nil, fmt.Errorf("unknown stream format %q, options are auto, y4m, rgb24", format)
+	}
+}
+
+// parseSize parses a "WxH" dimension string.
+func parseSize(size string) (int, int, error) {
+	w, h, found := strings.Cut(strings.ToLower(size), "x")
+	if !found {
+		return 0, 0, fmt.Errorf("invalid size %q", size)
+	}
+	width, err := strconv.Atoi(w)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid width in %q", size)
+	}
+	height, err := strconv.Atoi(h)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid height in %q", size)
+	}
+	return width, height, nil
+}
+
+// playStats summarizes a video playback run.
+type playStats struct {
+	rendered int
+	dropped  int
+}
+
+// playFrames renders every frame of the stream through a FrameRenderer and
+// writes it to out at the stream's frame rate. A frame is dropped without
+// rendering when the next frame is already due, so playback keeps pace
+// with the source instead of drifting further behind.
+func playFrames(
+	fr *img2ansi.FrameRenderer,
+	frames imageutil.FrameReader,
+	out io.Writer,
+) (playStats, error) {
+	var stats playStats
+	r := fr.Renderer()
+	frameDuration := time.Duration(float64(time.Second) / frames.FrameRate())
+
+	fmt.Fprint(out, "\x1b[?25l\x1b[2J")
+	defer fmt.Fprint(out, "\x1b[?25h")
+
+	start := time.Now()
+	for i := 0; ; i++ {
+		frame, err := frames.ReadFrame()
+		if err == io.EOF {
+			return stats, nil
+		}
+		if err != nil {
+			return stats, err
+		}
+
+		due := start.Add(time.Duration(i) * frameDuration)
+		if time.Now().After(due.Add(frameDuration)) {
+			stats.dropped++
+			continue
+		}
+
+		resized, edges := r.PrepareImage(frame)
+		blocks := fr.RenderFrame(resized, edges)
+		ansi := r.CompressBlocks(blocks)
+
+		time.Sleep(time.Until(due))
+		if _, err := fmt.Fprint(out, "\x1b[H"+ansi); err != nil {
+			return stats, err
+		}
+		stats.rendered++
+	}
+}
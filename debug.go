@@ -0,0 +1,90 @@
+package img2ansi
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/wbrown/img2ansi/imageutil"
+)
+
+// DebugSink receives the intermediate images of a render, so the stages
+// of the pipeline can be inspected. The images are:
+//
+//   - "resized": the image scaled to two pixels per block, before dithering
+//   - "edges": the edge map used to soften dithering on edges
+//   - "dithered": the chosen blocks drawn as a terminal would show them
+//   - "error": how far each shown pixel is from the resized one, brighter
+//     being further
+//
+// Images must not be modified or kept after DebugImage returns.
+type DebugSink interface {
+	DebugImage(name string, img image.Image) error
+}
+
+// DirSink is a DebugSink that writes each image to <dir>/<name>.png.
+type DirSink struct {
+	Dir string
+}
+
+// NewDirSink returns a DirSink writing to dir, which is created if it
+// doesn't exist.
+func NewDirSink(dir string) (*DirSink, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &DirSink{Dir: dir}, nil
+}
+
+// DebugImage writes img to <Dir>/<name>.png.
+func (s *DirSink) DebugImage(name string, img image.Image) error {
+	return imageutil.SavePNG(img, filepath.Join(s.Dir, name+".png"))
+}
+
+// debugImages sends the intermediate images of a render to the debug
+// sink, if there is one.
+func (r *Renderer) debugImages(
+	resized *imageutil.RGBAImage,
+	edges *imageutil.GrayImage,
+	blocks [][]BlockRune,
+) error {
+	if r.DebugSink == nil {
+		return nil
+	}
+	images := []struct {
+		name string
+		img  image.Image
+	}{
+		{"resized", resized.RGBA},
+		{"edges", edges.Gray},
+		{"dithered", Rasterize(blocks, RasterOptions{
+			CellHeight: int(8 * r.ScaleFactor),
+		})},
+		{"error", r.errorMap(resized, blocks)},
+	}
+	for _, i := range images {
+		if err := r.DebugSink.DebugImage(i.name, i.img); err != nil {
+			return fmt.Errorf("debug image %s: %w", i.name, err)
+		}
+	}
+	return nil
+}
+
+// errorMap returns the distance between each pixel of resized and the
+// color the block covering it shows, clamped to 255.
+func (r *Renderer) errorMap(
+	resized *imageutil.RGBAImage,
+	blocks [][]BlockRune,
+) *imageutil.GrayImage {
+	grid := subpixelGrid(blocks)
+	errs := imageutil.NewGrayImage(resized.Width(), resized.Height())
+	for y, row := range grid {
+		for x, shown := range row {
+			d := r.ColorMethod.Distance(rgbFromImageutil(resized.GetRGB(x, y)), shown)
+			errs.SetGrayValue(x, y, uint8(math.Min(255, math.Round(d))))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,85 @@
+package img2ansi
+
+import (
+	"errors"
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/wbrown/img2ansi/imageutil"
+)
+
+// recordingSink records the bounds of each debug image it receives.
+type recordingSink struct {
+	bounds map[string]image.Rectangle
+	err    error
+}
+
+func (s *recordingSink) DebugImage(name string, img image.Image) error {
+	s.bounds[name] = img.Bounds()
+	return s.err
+}
+
+func TestDebugSink(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.png")
+	if err := imageutil.SavePNG(noiseImage(64, 32).RGBA, input); err != nil {
+		t.Fatalf("Failed to write input: %v", err)
+	}
+
+	sink := &recordingSink{bounds: make(map[string]image.Rectangle)}
+	r := NewRenderer(WithPalette("ansi16"), WithTargetWidth(16),
+		WithDebugSink(sink))
+	if _, err := r.ImageToANSI(input); err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	// 16x4 blocks at two pixels each, drawn in 8x16 cells
+	expected := map[string]image.Rectangle{
+		"resized":  image.Rect(0, 0, 32, 8),
+		"edges":    image.Rect(0, 0, 32, 8),
+		"dithered": image.Rect(0, 0, 128, 64),
+		"error":    image.Rect(0, 0, 32, 8),
+	}
+	for name, want := range expected {
+		if got, ok := sink.bounds[name]; !ok {
+			t.Errorf("Missing debug image %q", name)
+		} else if got != want {
+			t.Errorf("Debug image %q is %v, want %v", name, got, want)
+		}
+	}
+
+	// A failing sink is reported without failing the render
+	sink.err = errors.New("disk full")
+	if _, err := r.ImageToANSI(input); err != nil {
+		t.Errorf("Expected the render to succeed, got %v", err)
+	}
+	result, err := r.RenderImage(noiseImage(64, 32))
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	if !errors.Is(result.DebugErr, sink.err) {
+		t.Errorf("Expected the sink's error, got %v", result.DebugErr)
+	}
+	if result.ANSI == "" {
+		t.Error("Expected rendered output despite the sink's error")
+	}
+
+	out := filepath.Join(dir, "debug")
+	dirSink, err := NewDirSink(out)
+	if err != nil {
+		t.Fatalf("Failed to create sink: %v", err)
+	}
+	r = NewRenderer(WithPalette("ansi16"), WithTargetWidth(16),
+		WithDebugSink(dirSink))
+	if _, err := r.ImageToANSI(input); err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	for name := range expected {
+		if _, err := os.Stat(filepath.Join(out, name+".png")); err != nil {
+			t.Errorf("Expected %s.png: %v", name, err)
+		}
+	}
+}
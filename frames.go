@@ -0,0 +1,207 @@
+package img2ansi
+
+import (
+	"math"
+
+	"github.com/wbrown/img2ansi/imageutil"
+)
+
+// FrameErrorMode controls what happens to the dithering error that is left
+// over at the end of a frame.
+type FrameErrorMode int
+
+const (
+	// FrameErrorReset starts every frame with no accumulated error. This is
+	// the most stable choice for static or slowly moving scenes.
+	FrameErrorReset FrameErrorMode = iota
+
+	// FrameErrorCarry adds the residual error of each pixel from the
+	// previous frame, scaled by the carry factor, to the same pixel of the
+	// next frame before it is dithered.
+	FrameErrorCarry
+)
+
+// FrameRenderer renders successive frames of a video or animation with
+// temporal coherence. Rendering each frame independently with
+// BrownDitherForBlocks makes the dither pattern flicker even when the
+// scene is static, because tiny input changes are amplified by the error
+// diffusion. FrameRenderer remembers the previous frame's blocks and keeps
+// a cell's glyph and colors whenever they are within the hysteresis margin
+// of the best representation for the new frame. The best representation
+// is chosen as BrownDitherForBlocks chooses it, including the Renderer's
+// RateLambda.
+//
+// The error diffused into neighboring blocks is always computed from the
+// representation that is actually emitted, so reused cells and freshly
+// solved cells stay consistent with each other.
+//
+// A FrameRenderer is not safe for concurrent use.
+type FrameRenderer struct {
+	// Hysteresis is the extra block error, in units of the Renderer's
+	// ColorMethod, that a previous cell may have over the best
+	// representation and still be reused.
+	Hysteresis float64
+	// ErrorMode selects whether residual error is reset or carried over
+	// between frames.
+	ErrorMode FrameErrorMode
+	// CarryFactor scales the residual error carried into the next frame
+	// when ErrorMode is FrameErrorCarry.
+	CarryFactor float64
+
+	renderer *Renderer
+	prev     [][]BlockRune
+	residual []RGBError
+	// width and height are the pixel dimensions of the previous frame,
+	// which prev and residual were computed for.
+	width, height int
+	reused        int
+}
+
+// FrameRendererOption is a functional option for configuring a
+// FrameRenderer.
+type FrameRendererOption func(*FrameRenderer)
+
+// NewFrameRenderer creates a FrameRenderer that uses r for palette lookups
+// and block selection. Default values: Hysteresis=30, ErrorMode=
+// FrameErrorReset, CarryFactor=0.5.
+func NewFrameRenderer(r *Renderer, opts ...FrameRendererOption) *FrameRenderer {
+	fr := &FrameRenderer{
+		Hysteresis:  30.0,
+		ErrorMode:   FrameErrorReset,
+		CarryFactor: 0.5,
+		renderer:    r,
+	}
+	for _, opt := range opts {
+		opt(fr)
+	}
+	return fr
+}
+
+// WithHysteresis sets the error margin within which a previous frame's
+// cell is reused.
+func WithHysteresis(margin float64) FrameRendererOption {
+	return func(fr *FrameRenderer) {
+		fr.Hysteresis = margin
+	}
+}
+
+// WithErrorCarry carries the residual dithering error of each frame into
+// the next one, scaled by factor.
+func WithErrorCarry(factor float64) FrameRendererOption {
+	return func(fr *FrameRenderer) {
+		fr.ErrorMode = FrameErrorCarry
+		fr.CarryFactor = factor
+	}
+}
+
+// Renderer returns the Renderer used for block selection.
+func (fr *FrameRenderer) Renderer() *Renderer {
+	return fr.renderer
+}
+
+// Reset forgets the previous frame, so the next frame is rendered from
+// scratch. Call this on scene cuts.
+func (fr *FrameRenderer) Reset() {
+	fr.prev = nil
+	fr.residual = nil
+	fr.width, fr.height = 0, 0
+	fr.reused = 0
+}
+
+// ReusedCells returns the number of cells in the last frame that were
+// taken over unchanged from the frame before it.
+func (fr *FrameRenderer) ReusedCells() int {
+	return fr.reused
+}
+
+// RenderFrame dithers one frame. The image and edge map are expected to
+// come from imageutil.PrepareForANSI, as for BrownDitherForBlocks, and img
+// is modified in place. If the frame's pixel size differs from the
+// previous frame, the state is reset first.
+func (fr *FrameRenderer) RenderFrame(
+	img *imageutil.RGBAImage,
+	edges *imageutil.GrayImage,
+) [][]BlockRune {
+	r := fr.renderer
+	if img.Width() != fr.width || img.Height() != fr.height {
+		fr.Reset()
+	}
+
+	if fr.ErrorMode == FrameErrorCarry && fr.residual != nil {
+		fr.applyResidual(img)
+	}
+
+	fr.reused = 0
+	choose := r.chooser(r.RateLambda)
+	blocks := r.ditherBlocks(img, edges,
+		func(bx, by int, block [4]RGB, isEdge bool) (rune, RGB, RGB) {
+			bestRune, bestFG, bestBG := choose(bx, by, block, isEdge)
+			if fr.prev == nil {
+				return bestRune, bestFG, bestBG
+			}
+			prev := fr.prev[by][bx]
+			if prev == (BlockRune{Rune: bestRune, FG: bestFG, BG: bestBG}) {
+				fr.reused++
+				return bestRune, bestFG, bestBG
+			}
+			bestError := r.calculateBlockError(block,
+				getQuadrantsForRune(bestRune), bestFG, bestBG, isEdge)
+			prevError := r.calculateBlockError(block,
+				getQuadrantsForRune(prev.Rune), prev.FG, prev.BG, isEdge)
+			if prevError <= bestError+fr.Hysteresis {
+				fr.reused++
+				return prev.Rune, prev.FG, prev.BG
+			}
+			return bestRune, bestFG, bestBG
+		})
+
+	if fr.ErrorMode == FrameErrorCarry {
+		fr.residual = computeResidual(img, blocks)
+	}
+	fr.prev = blocks
+	fr.width, fr.height = img.Width(), img.Height()
+	return blocks
+}
+
+// applyResidual adds the carried residual error to every pixel of img.
+func (fr *FrameRenderer) applyResidual(img *imageutil.RGBAImage) {
+	width := img.Width()
+	for i, e := range fr.residual {
+		x, y := i%width, i/width
+		pixel := img.GetRGB(x, y)
+		img.SetRGB(x, y, imageutil.RGB{
+			R: clampChannel(float64(pixel.R) + float64(e.R)*fr.CarryFactor),
+			G: clampChannel(float64(pixel.G) + float64(e.G)*fr.CarryFactor),
+			B: clampChannel(float64(pixel.B) + float64(e.B)*fr.CarryFactor),
+		})
+	}
+}
+
+// computeResidual returns, for every pixel of the dithered image, the
+// difference between its final value and the color that was emitted for
+// it. The slice is indexed by y*width+x.
+func computeResidual(img *imageutil.RGBAImage, blocks [][]BlockRune) []RGBError {
+	width := img.Width()
+	residual := make([]RGBError, width*img.Height())
+	for by, row := range blocks {
+		for bx, block := range row {
+			quad := getQuadrantsForRune(block.Rune)
+			for i := 0; i < 4; i++ {
+				x, y := bx*2+i%2, by*2+i/2
+				target := block.BG
+				if isQuadrantActive(quad, i%2, i/2) {
+					target = block.FG
+				}
+				residual[y*width+x] = rgbFromImageutil(
+					img.GetRGB(x, y)).subtractToError(target)
+			}
+		}
+	}
+	return residual
+}
+
+// clampChannel rounds v and clamps it to the 0-255 range of a color
+// channel.
+func clampChannel(v float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, math.Round(v))))
+}
@@ -0,0 +1,176 @@
+package img2ansi
+
+import (
+	"testing"
+
+	"github.com/wbrown/img2ansi/imageutil"
+)
+
+// noisyFrame returns a gradient image with a small per-frame perturbation,
+// imitating sensor or compression noise in a static video scene.
+func noisyFrame(width, height, seed int) *imageutil.RGBAImage {
+	img := imageutil.CreateGradientImage(width, height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			p := img.GetRGB(x, y)
+			n := uint8((x*7 + y*13 + seed*31) % 5)
+			img.SetRGB(x, y, imageutil.RGB{R: p.R + n, G: p.G + n, B: p.B})
+		}
+	}
+	return img
+}
+
+func countChangedCells(a, b [][]BlockRune) int {
+	changed := 0
+	for y := range a {
+		for x := range a[y] {
+			if a[y][x] != b[y][x] {
+				changed++
+			}
+		}
+	}
+	return changed
+}
+
+func TestFrameRendererStaticScene(t *testing.T) {
+	t.Parallel()
+
+	r := NewRenderer(WithPalette("ansi16"))
+	fr := NewFrameRenderer(r)
+
+	width, height := 40, 20
+	img := imageutil.CreateGradientImage(width*2, height*2)
+	resized, edges := imageutil.PrepareForANSI(img, width, height)
+	first := fr.RenderFrame(resized.Clone(), edges)
+	second := fr.RenderFrame(resized.Clone(), edges)
+
+	if changed := countChangedCells(first, second); changed != 0 {
+		t.Errorf("Identical frames changed %d cells", changed)
+	}
+	if fr.ReusedCells() != width*height {
+		t.Errorf("Expected all %d cells reused, got %d",
+			width*height, fr.ReusedCells())
+	}
+}
+
+func TestFrameRendererReducesFlicker(t *testing.T) {
+	t.Parallel()
+
+	r := NewRenderer(WithPalette("ansi16"))
+	width, height := 40, 20
+
+	var independent, coherent int
+	fr := NewFrameRenderer(r, WithHysteresis(60))
+	var prevIndependent, prevCoherent [][]BlockRune
+	for frame := 0; frame < 4; frame++ {
+		src := noisyFrame(width*2, height*2, frame)
+		resized, edges := imageutil.PrepareForANSI(src, width, height)
+
+		blocks := r.BrownDitherForBlocks(resized.Clone(), edges)
+		stable := fr.RenderFrame(resized.Clone(), edges)
+		if prevIndependent != nil {
+			independent += countChangedCells(prevIndependent, blocks)
+			coherent += countChangedCells(prevCoherent, stable)
+		}
+		prevIndependent, prevCoherent = blocks, stable
+	}
+
+	t.Logf("Changed cells: independent=%d, coherent=%d", independent, coherent)
+	if coherent > independent {
+		t.Errorf("Temporal coherence should not increase flicker: "+
+			"independent=%d, coherent=%d", independent, coherent)
+	}
+}
+
+func TestFrameRendererResizeResets(t *testing.T) {
+	t.Parallel()
+
+	r := NewRenderer(WithPalette("ansi16"))
+	fr := NewFrameRenderer(r, WithErrorCarry(0.5))
+
+	small, smallEdges := imageutil.PrepareForANSI(
+		imageutil.CreateGradientImage(20, 20), 10, 5)
+	fr.RenderFrame(small, smallEdges)
+
+	large, largeEdges := imageutil.PrepareForANSI(
+		imageutil.CreateGradientImage(40, 40), 20, 10)
+	blocks := fr.RenderFrame(large, largeEdges)
+
+	if len(blocks) != 10 || len(blocks[0]) != 20 {
+		t.Fatalf("Expected 20x10 blocks, got %dx%d", len(blocks[0]), len(blocks))
+	}
+	if fr.ReusedCells() != 0 {
+		t.Errorf("Expected no reuse after a size change, got %d", fr.ReusedCells())
+	}
+}
+
+func TestFrameRendererCarriesResidual(t *testing.T) {
+	t.Parallel()
+
+	r := NewRenderer(WithPalette("ansi16"))
+	fr := NewFrameRenderer(r, WithErrorCarry(1.0))
+
+	// Mid gray has no exact ansi16 match, so every frame leaves a residual.
+	gray := imageutil.RGB{R: 100, G: 100, B: 100}
+	edges := imageutil.NewGrayImage(8, 8)
+	fr.RenderFrame(imageutil.CreateSolidImage(8, 8, gray), edges)
+	if len(fr.residual) != 8*8 {
+		t.Fatalf("Expected a residual for 64 pixels, got %d", len(fr.residual))
+	}
+	carried := fr.residual[0]
+	if carried == (RGBError{}) {
+		t.Fatal("Expected a non-zero residual for the first pixel")
+	}
+
+	// The first pixel receives no error diffused within the frame, so after
+	// rendering it holds exactly the input plus the carried residual.
+	next := imageutil.CreateSolidImage(8, 8, gray)
+	fr.RenderFrame(next, edges)
+	want := imageutil.RGB{
+		R: clampChannel(float64(gray.R) + float64(carried.R)),
+		G: clampChannel(float64(gray.G) + float64(carried.G)),
+		B: clampChannel(float64(gray.B) + float64(carried.B)),
+	}
+	if got := next.GetRGB(0, 0); got != want {
+		t.Errorf("Expected first pixel %v after carry, got %v", want, got)
+	}
+}
+
+func TestFrameRendererPixelResizeResets(t *testing.T) {
+	t.Parallel()
+
+	r := NewRenderer(WithPalette("ansi16"))
+	fr := NewFrameRenderer(r, WithErrorCarry(0.5))
+
+	// 5x4 and 4x4 pixels both give 2x2 blocks, but the residual of the
+	// first frame doesn't fit the second.
+	fr.RenderFrame(imageutil.CreateGradientImage(5, 4),
+		imageutil.NewGrayImage(5, 4))
+	blocks := fr.RenderFrame(imageutil.CreateGradientImage(4, 4),
+		imageutil.NewGrayImage(4, 4))
+
+	if len(blocks) != 2 || len(blocks[0]) != 2 {
+		t.Fatalf("Expected 2x2 blocks, got %dx%d", len(blocks[0]), len(blocks))
+	}
+	if fr.ReusedCells() != 0 {
+		t.Errorf("Expected no reuse after a size change, got %d", fr.ReusedCells())
+	}
+	if len(fr.residual) != 4*4 {
+		t.Errorf("Expected a residual for 16 pixels, got %d", len(fr.residual))
+	}
+}
+
+func TestFrameRendererRateLambda(t *testing.T) {
+	t.Parallel()
+
+	// The first frame has nothing to reuse, so it must be chosen exactly as
+	// BrownDitherForBlocks chooses it, rate-distortion cost included
+	r := NewRenderer(WithPalette("ansi16"), WithRateLambda(30))
+	img := noiseImage(40, 30)
+	edges := imageutil.NewGrayImage(40, 30)
+	want := r.BrownDitherForBlocks(img.Clone(), edges)
+	got := NewFrameRenderer(r).RenderFrame(img.Clone(), edges)
+	if changed := countChangedCells(want, got); changed != 0 {
+		t.Errorf("Expected the rate-distortion choice, %d cells differ", changed)
+	}
+}
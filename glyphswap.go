@@ -0,0 +1,184 @@
+package img2ansi
+
+import (
+	"unicode/utf8"
+)
+
+// cellOption is one way of drawing a cell: a glyph and the colors it
+// needs. A color that isn't needed is left as the terminal has it.
+type cellOption struct {
+	ch             rune
+	fg, bg         RGB
+	needFG, needBG bool
+}
+
+// solidColor returns the only color a cell shows, if it shows just one.
+func solidColor(block BlockRune) (RGB, bool) {
+	switch block.Rune {
+	case ' ':
+		return block.BG, true
+	case '█':
+		return block.FG, true
+	}
+	if block.FG == block.BG && Blocks[blockIndex(block.Rune)].Rune == block.Rune {
+		return block.FG, true
+	}
+	return RGB{}, false
+}
+
+// options returns the equivalent ways of drawing block. A solid cell can
+// be a space in its background or a full block in its foreground, using
+// whichever colors the palettes have. With ComplementSwap, a quadrant
+// glyph can also be drawn as its complement with the colors swapped, as
+// long as the palettes have both colors in their new roles.
+func (e *ansiEncoder) options(block BlockRune) []cellOption {
+	if solid, ok := solidColor(block); ok {
+		_, fgOK := e.fgCode(solid)
+		_, bgOK := e.bgCode(solid)
+		var opts []cellOption
+		if bgOK || !fgOK {
+			opts = append(opts, cellOption{ch: ' ', bg: solid, needBG: true})
+		}
+		if fgOK {
+			opts = append(opts, cellOption{ch: '█', fg: solid, needFG: true})
+		}
+		return opts
+	}
+
+	opts := []cellOption{{
+		ch: block.Rune, fg: block.FG, bg: block.BG,
+		needFG: true, needBG: true,
+	}}
+	if !e.r.ComplementSwap {
+		return opts
+	}
+	idx := blockIndex(block.Rune)
+	if Blocks[idx].Rune != block.Rune {
+		return opts
+	}
+	_, fgOK := e.fgCode(block.BG)
+	_, bgOK := e.bgCode(block.FG)
+	if fgOK && bgOK {
+		opts = append(opts, cellOption{
+			ch: Blocks[15-idx].Rune, fg: block.BG, bg: block.FG,
+			needFG: true, needBG: true,
+		})
+	}
+	return opts
+}
+
+// planNode is a terminal state reached after a cell, with the cheapest
+// cost of reaching it and how.
+type planNode struct {
+	state  termState
+	cost   int
+	prev   int // index of the node in the previous layer
+	option int // index of the option drawn for this cell
+}
+
+// resetCost returns the most it can cost to go from any state to one at
+// least as good as s: one sequence setting each of its known colors.
+func (e *ansiEncoder) resetCost(s termState) int {
+	var fg, bg string
+	if s.fgKnown {
+		fg, _ = e.fgCode(s.fg)
+	}
+	if s.bgKnown {
+		bg, _ = e.bgCode(s.bg)
+	}
+	return sgrLength(fg, bg)
+}
+
+// planRow chooses how to draw each cell of row, starting from state
+// start, so that the row takes the fewest bytes. It searches all
+// combinations of each cell's options by dynamic programming over the
+// terminal states they lead to. A state that costs more than getting to
+// it from the cheapest state is dropped, which keeps the search small.
+func (e *ansiEncoder) planRow(start termState, row []BlockRune) []cellOption {
+	if len(row) == 0 {
+		return nil
+	}
+	options := make([][]cellOption, len(row))
+	layers := make([][]planNode, len(row))
+	prev := []planNode{{state: start}}
+	for x, block := range row {
+		options[x] = e.options(block)
+		var layer []planNode
+		index := make(map[termState]int)
+		for pi, p := range prev {
+			for oi, o := range options[x] {
+				fg, bg, next := e.transition(p.state, o)
+				cost := p.cost + sgrLength(fg, bg) + utf8.RuneLen(o.ch)
+				if i, ok := index[next]; ok {
+					if cost < layer[i].cost {
+						layer[i] = planNode{next, cost, pi, oi}
+					}
+					continue
+				}
+				index[next] = len(layer)
+				layer = append(layer, planNode{next, cost, pi, oi})
+			}
+		}
+
+		best := 0
+		for i := range layer {
+			if layer[i].cost < layer[best].cost {
+				best = i
+			}
+		}
+		kept := layer[:0]
+		bestCost := layer[best].cost
+		for _, n := range layer {
+			if n.cost < bestCost+e.resetCost(n.state) || n.cost == bestCost {
+				kept = append(kept, n)
+			}
+		}
+		layers[x] = kept
+		prev = kept
+	}
+
+	best := 0
+	for i, n := range prev {
+		if n.cost < prev[best].cost {
+			best = i
+		}
+	}
+	plan := make([]cellOption, len(row))
+	for x := len(row) - 1; x >= 0; x-- {
+		n := layers[x][best]
+		plan[x] = options[x][n.option]
+		best = n.prev
+	}
+	return plan
+}
+
+// SwapComplements returns blocks with each cell drawn in the equivalent
+// way that lets CompressBlocks write the fewest escape sequences. A
+// quadrant glyph with its colors swapped looks the same as its
+// complement, e.g. ▘ in A on B and ▟ in B on A, and a solid cell can be a
+// space or a full block; choosing between them keeps the terminal's
+// colors unchanged for longer runs. The result looks exactly like the
+// input. Colors a cell doesn't show are set to the terminal's current
+// ones.
+func (r *Renderer) SwapComplements(blocks [][]BlockRune) [][]BlockRune {
+	e := newANSIEncoder(r)
+	result := make([][]BlockRune, len(blocks))
+	for y, row := range blocks {
+		result[y] = make([]BlockRune, len(row))
+		for x, o := range e.planRow(e.state, row) {
+			_, _, next := e.transition(e.state, o)
+			result[y][x] = BlockRune{Rune: o.ch, FG: next.fg, BG: next.bg}
+			if !o.needFG && !next.fgKnown {
+				result[y][x].FG = row[x].FG
+			}
+			if !o.needBG && !next.bgKnown {
+				result[y][x].BG = row[x].BG
+			}
+			e.state = next
+		}
+		if r.LineReset {
+			e.state = termState{}
+		}
+	}
+	return result
+}
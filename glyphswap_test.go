@@ -0,0 +1,85 @@
+package img2ansi
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestSwapComplements(t *testing.T) {
+	t.Parallel()
+
+	red, black, blue := RGB{0xAA, 0, 0}, RGB{0, 0, 0}, RGB{0, 0, 0xAA}
+	blocks := [][]BlockRune{{
+		{'▀', red, black},
+		{'▄', black, red}, // same as ▀ in red on black
+		{'▄', black, red},
+		{'▟', black, red},  // same as ▘ in red on black
+		{'█', black, blue}, // solid black is already the background
+	}}
+
+	r := NewRenderer(WithPalette("ansi16"))
+	expected := ESC + "[31;40m▀▀▀▘ " + ESC + "[0m\n"
+	if got := r.CompressBlocks(blocks); got != expected {
+		t.Errorf("Unexpected output:\n got %q\nwant %q", got, expected)
+	}
+	swapped := r.SwapComplements(blocks)
+	want := []BlockRune{
+		{'▀', red, black}, {'▀', red, black}, {'▀', red, black},
+		{'▘', red, black}, {' ', red, black},
+	}
+	for x := range want {
+		if swapped[0][x] != want[x] {
+			t.Errorf("Cell %d = %v, want %v", x, swapped[0][x], want[x])
+		}
+	}
+
+	r = NewRenderer(WithPalette("ansi16"), WithComplementSwap(false))
+	expected = ESC + "[31;40m▀" + ESC + "[30;41m▄▄▟█" + ESC + "[0m\n"
+	if got := r.CompressBlocks(blocks); got != expected {
+		t.Errorf("Unexpected output without swapping:\n got %q\nwant %q", got, expected)
+	}
+}
+
+func TestSwapComplementsRandom(t *testing.T) {
+	t.Parallel()
+
+	r := NewRenderer(WithPalette("ansi16"))
+	plain := NewRenderer(WithPalette("ansi16"), WithComplementSwap(false))
+	colors := r.fgColors[:4]
+	rng := rand.New(rand.NewSource(1))
+	blocks := make([][]BlockRune, 20)
+	for y := range blocks {
+		blocks[y] = make([]BlockRune, 40)
+		for x := range blocks[y] {
+			blocks[y][x] = BlockRune{
+				Rune: Blocks[rng.Intn(len(Blocks))].Rune,
+				FG:   colors[rng.Intn(len(colors))],
+				BG:   colors[rng.Intn(len(colors))],
+			}
+		}
+	}
+
+	swapped := r.SwapComplements(blocks)
+	for y := range blocks {
+		for x := range blocks[y] {
+			if !sameLook(swapped[y][x], blocks[y][x]) {
+				t.Fatalf("Cell (%d,%d) changed from %v to %v",
+					x, y, blocks[y][x], swapped[y][x])
+			}
+		}
+	}
+
+	compressed := r.CompressBlocks(blocks)
+	if n, m := len(compressed), len(plain.CompressBlocks(blocks)); n >= m {
+		t.Errorf("Expected swapping to shrink output, got %d bytes vs %d", n, m)
+	}
+	parsed, _ := r.ParseANSI([]byte(compressed))
+	for y := range blocks {
+		for x := range blocks[y] {
+			if !sameLook(parsed[y][x], blocks[y][x]) {
+				t.Fatalf("Compressed cell (%d,%d) reads back as %v, want %v",
+					x, y, parsed[y][x], blocks[y][x])
+			}
+		}
+	}
+}
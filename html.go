@@ -0,0 +1,333 @@
+package img2ansi
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strings"
+)
+
+// HTMLOptions controls the HTML produced by EncodeHTML.
+type HTMLOptions struct {
+	// Title is the document title.
+	Title string
+	// FontFamily is the CSS font-family used for the text grid, a comma
+	// separated list of family names. Names that aren't plain identifiers
+	// are written as quoted CSS strings.
+	FontFamily string
+	// FontSize is the CSS font-size of the text grid, e.g. "14px". It may
+	// only contain letters, digits, '.' and '%'.
+	FontSize string
+	// LineHeight is the CSS line-height of the text grid. Block glyphs only
+	// join up vertically at 1.0 or below.
+	LineHeight float64
+	// CSSQuadrants draws every cell as a fixed-size box whose quadrants
+	// are painted with background gradients instead of block characters,
+	// so the result doesn't depend on the viewer's fonts.
+	CSSQuadrants bool
+	// CellWidth and CellHeight are the cell size in pixels used when
+	// CSSQuadrants is set.
+	CellWidth  int
+	CellHeight int
+}
+
+// DefaultHTMLOptions returns the options used when fields are left zero.
+func DefaultHTMLOptions() HTMLOptions {
+	return HTMLOptions{
+		Title:      "img2ansi",
+		FontFamily: "'DejaVu Sans Mono', Menlo, Consolas, monospace",
+		FontSize:   "14px",
+		LineHeight: 1.0,
+		CellWidth:  8,
+		CellHeight: 16,
+	}
+}
+
+// withDefaults fills zero fields from DefaultHTMLOptions.
+func (o HTMLOptions) withDefaults() HTMLOptions {
+	d := DefaultHTMLOptions()
+	if o.Title == "" {
+		o.Title = d.Title
+	}
+	if o.FontFamily == "" {
+		o.FontFamily = d.FontFamily
+	}
+	if o.FontSize == "" {
+		o.FontSize = d.FontSize
+	}
+	if o.LineHeight == 0 {
+		o.LineHeight = d.LineHeight
+	}
+	if o.CellWidth == 0 {
+		o.CellWidth = d.CellWidth
+	}
+	if o.CellHeight == 0 {
+		o.CellHeight = d.CellHeight
+	}
+	return o
+}
+
+// EncodeHTML writes blocks as a standalone HTML document. Colors are the
+// blocks' RGB values, so the page shows the palette's real colors rather
+// than whatever the browser or terminal theme maps ANSI codes to.
+//
+// In text mode each row is a run of <span> elements, one per stretch of
+// cells sharing the same colors, with colors expressed as shared CSS
+// classes. As in CompressANSI, a space only needs its background and a
+// full block only its foreground, which lets runs grow across them.
+func EncodeHTML(w io.Writer, blocks [][]BlockRune, opts HTMLOptions) error {
+	opts = opts.withDefaults()
+	if !isCSSSize(opts.FontSize) {
+		return fmt.Errorf("invalid font size %q", opts.FontSize)
+	}
+	bw := bufio.NewWriter(w)
+
+	fgUsed := make(map[RGB]bool)
+	bgUsed := make(map[RGB]bool)
+	for _, row := range blocks {
+		for _, block := range row {
+			if block.Rune != ' ' || opts.CSSQuadrants {
+				fgUsed[block.FG] = true
+			}
+			if block.Rune != '█' || opts.CSSQuadrants {
+				bgUsed[block.BG] = true
+			}
+		}
+	}
+
+	fmt.Fprintf(bw, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(bw, "<title>%s</title>\n<style>\n", html.EscapeString(opts.Title))
+	fmt.Fprintf(bw, "body { background: #000; margin: 0; }\n")
+	if opts.CSSQuadrants {
+		writeQuadrantCSS(bw, opts, fgUsed, bgUsed)
+	} else {
+		fmt.Fprintf(bw, "pre.ansi { margin: 0; font-family: %s; "+
+			"font-size: %s; line-height: %g; }\n",
+			cssFontFamily(opts.FontFamily), opts.FontSize, opts.LineHeight)
+		for _, c := range sortedColors(fgUsed) {
+			fmt.Fprintf(bw, ".f%s { color: #%s; }\n", c.hex(), c.hex())
+		}
+		for _, c := range sortedColors(bgUsed) {
+			fmt.Fprintf(bw, ".b%s { background-color: #%s; }\n", c.hex(), c.hex())
+		}
+	}
+	fmt.Fprintf(bw, "</style>\n</head>\n<body>\n")
+
+	if opts.CSSQuadrants {
+		writeQuadrantCells(bw, blocks)
+	} else {
+		writeTextRuns(bw, blocks)
+	}
+
+	fmt.Fprintf(bw, "</body>\n</html>\n")
+	return bw.Flush()
+}
+
+// RenderToHTML renders blocks to an HTML document string. It returns an
+// empty string if EncodeHTML rejects the options.
+func RenderToHTML(blocks [][]BlockRune, opts HTMLOptions) string {
+	var sb strings.Builder
+	_ = EncodeHTML(&sb, blocks, opts)
+	return sb.String()
+}
+
+// writeTextRuns writes the grid as a <pre> of merged color spans.
+func writeTextRuns(w *bufio.Writer, blocks [][]BlockRune) {
+	w.WriteString("<pre class=\"ansi\">")
+	for y, row := range blocks {
+		if y > 0 {
+			w.WriteByte('\n')
+		}
+		var run strings.Builder
+		var runFG, runBG RGB
+		var hasFG, hasBG bool
+		flush := func() {
+			if run.Len() == 0 {
+				return
+			}
+			var classes []string
+			if hasFG {
+				classes = append(classes, "f"+runFG.hex())
+			}
+			if hasBG {
+				classes = append(classes, "b"+runBG.hex())
+			}
+			fmt.Fprintf(w, "<span class=\"%s\">%s</span>",
+				strings.Join(classes, " "), html.EscapeString(run.String()))
+			run.Reset()
+			hasFG, hasBG = false, false
+		}
+
+		for _, block := range row {
+			needFG := block.Rune != ' '
+			needBG := block.Rune != '█'
+			if (needFG && hasFG && block.FG != runFG) ||
+				(needBG && hasBG && block.BG != runBG) {
+				flush()
+			}
+			if needFG && !hasFG {
+				runFG, hasFG = block.FG, true
+			}
+			if needBG && !hasBG {
+				runBG, hasBG = block.BG, true
+			}
+			run.WriteRune(block.Rune)
+		}
+		flush()
+	}
+	w.WriteString("</pre>\n")
+}
+
+// quadrantPositions are the CSS background positions of the top-left,
+// top-right, bottom-left and bottom-right quadrants.
+var quadrantPositions = [4]string{"0 0", "100% 0", "0 100%", "100% 100%"}
+
+// writeQuadrantCSS writes the stylesheet for CSS-only quadrant rendering.
+// Each glyph gets a class that layers one gradient per filled quadrant in
+// the cell's --fg color over its --bg background.
+func writeQuadrantCSS(
+	w *bufio.Writer,
+	opts HTMLOptions,
+	fgUsed, bgUsed map[RGB]bool,
+) {
+	fmt.Fprintf(w, ".grid div { display: flex; height: %dpx; }\n", opts.CellHeight)
+	fmt.Fprintf(w, ".grid i { display: block; flex: none; width: %dpx; "+
+		"height: %dpx; background-color: var(--bg); "+
+		"background-size: 50%% 50%%; background-repeat: no-repeat; }\n",
+		opts.CellWidth, opts.CellHeight)
+	for i, b := range Blocks {
+		quadrants := [4]bool{
+			b.Quad.TopLeft, b.Quad.TopRight,
+			b.Quad.BottomLeft, b.Quad.BottomRight,
+		}
+		var layers, positions []string
+		for q, filled := range quadrants {
+			if filled {
+				layers = append(layers, "linear-gradient(var(--fg), var(--fg))")
+				positions = append(positions, quadrantPositions[q])
+			}
+		}
+		if len(layers) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, ".g%d { background-image: %s; background-position: %s; }\n",
+			i, strings.Join(layers, ", "), strings.Join(positions, ", "))
+	}
+	for _, c := range sortedColors(fgUsed) {
+		fmt.Fprintf(w, ".f%s { --fg: #%s; }\n", c.hex(), c.hex())
+	}
+	for _, c := range sortedColors(bgUsed) {
+		fmt.Fprintf(w, ".b%s { --bg: #%s; }\n", c.hex(), c.hex())
+	}
+}
+
+// writeQuadrantCells writes one box per cell for CSS-only rendering.
+func writeQuadrantCells(w *bufio.Writer, blocks [][]BlockRune) {
+	w.WriteString("<div class=\"grid\">\n")
+	for _, row := range blocks {
+		w.WriteString("<div>")
+		for _, block := range row {
+			fmt.Fprintf(w, "<i class=\"g%d f%s b%s\"></i>",
+				blockIndex(block.Rune), block.FG.hex(), block.BG.hex())
+		}
+		w.WriteString("</div>\n")
+	}
+	w.WriteString("</div>\n")
+}
+
+// blockIndex returns the index of r in Blocks, or 0 (space) if r is not a
+// block character.
+func blockIndex(r rune) int {
+	for i, b := range Blocks {
+		if b.Rune == r {
+			return i
+		}
+	}
+	return 0
+}
+
+// hex returns the color as a six digit lowercase hex string.
+func (rgb RGB) hex() string {
+	return fmt.Sprintf("%02x%02x%02x", rgb.R, rgb.G, rgb.B)
+}
+
+// sortedColors returns the keys of a color set in a stable order.
+func sortedColors(set map[RGB]bool) []RGB {
+	colors := make(sortableRGB, 0, len(set))
+	for c := range set {
+		colors = append(colors, c)
+	}
+	sort.Sort(colors)
+	return colors
+}
+
+// cssFontFamily returns a font-family list safe to write into a <style>
+// element. Unquoted names made of letters, digits, '-' and spaces, such
+// as monospace, are kept as they are; any other name is written as a CSS
+// string.
+func cssFontFamily(list string) string {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		quoted := len(name) >= 2 && (name[0] == '\'' || name[0] == '"') &&
+			name[len(name)-1] == name[0]
+		if quoted {
+			name = name[1 : len(name)-1]
+		} else if isCSSIdent(name) {
+			names = append(names, name)
+			continue
+		}
+		names = append(names, cssString(name))
+	}
+	return strings.Join(names, ", ")
+}
+
+// isCSSIdent reports whether s is a sequence of identifiers separated by
+// spaces, which CSS reads as an unquoted font family name.
+func isCSSIdent(s string) bool {
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+			c >= '0' && c <= '9' || c == '-' || c == ' ') {
+			return false
+		}
+	}
+	return s[0] < '0' || s[0] > '9'
+}
+
+// isCSSSize reports whether s is made only of letters, digits, '.' and
+// '%', like a CSS length.
+func isCSSSize(s string) bool {
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+			c >= '0' && c <= '9' || c == '.' || c == '%') {
+			return false
+		}
+	}
+	return true
+}
+
+// cssString quotes s as a CSS string. Besides quotes and backslashes, it
+// escapes '<' and control characters, so the string can't end the <style>
+// element it is written into.
+func cssString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, c := range s {
+		switch {
+		case c == '"' || c == '\\':
+			sb.WriteByte('\\')
+			sb.WriteRune(c)
+		case c == '<' || c < 0x20 || c == 0x7F:
+			fmt.Fprintf(&sb, "\\%x ", c)
+		default:
+			sb.WriteRune(c)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
@@ -0,0 +1,81 @@
+package img2ansi
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncodeHTMLMergesRuns(t *testing.T) {
+	t.Parallel()
+
+	red, black, blue := RGB{255, 0, 0}, RGB{0, 0, 0}, RGB{0, 0, 255}
+	blocks := [][]BlockRune{{
+		{'▀', red, black},
+		{'▄', red, black},
+		{' ', blue, black}, // fg is irrelevant for a space
+		{'▌', blue, black},
+	}}
+
+	out := RenderToHTML(blocks, HTMLOptions{Title: "<test>"})
+
+	if !strings.Contains(out, "<title>&lt;test&gt;</title>") {
+		t.Error("Title should be HTML-escaped")
+	}
+	if !strings.Contains(out, `<span class="fff0000 b000000">▀▄ </span>`) {
+		t.Errorf("Expected first three cells in one run, got:\n%s", out)
+	}
+	if !strings.Contains(out, `<span class="f0000ff b000000">▌</span>`) {
+		t.Errorf("Expected a separate run for the blue cell, got:\n%s", out)
+	}
+	if !strings.Contains(out, ".fff0000 { color: #ff0000; }") {
+		t.Error("Expected a foreground class with the palette RGB value")
+	}
+	if strings.Contains(out, ".b0000ff") {
+		t.Error("Unused colors should not get classes")
+	}
+}
+
+func TestEncodeHTMLCSSQuadrants(t *testing.T) {
+	t.Parallel()
+
+	blocks := [][]BlockRune{{
+		{'▚', RGB{255, 255, 255}, RGB{0, 0, 0}},
+	}}
+	out := RenderToHTML(blocks, HTMLOptions{CSSQuadrants: true, CellWidth: 10})
+
+	if strings.Contains(out, "▚") {
+		t.Error("CSS quadrant mode should not depend on block glyphs")
+	}
+	if !strings.Contains(out, `<i class="g9 fffffff b000000"></i>`) {
+		t.Errorf("Expected a glyph cell, got:\n%s", out)
+	}
+	if !strings.Contains(out, ".g9 { background-image: linear-gradient(var(--fg), var(--fg)), "+
+		"linear-gradient(var(--fg), var(--fg)); background-position: 0 0, 100% 100%; }") {
+		t.Errorf("Expected diagonal quadrant layers, got:\n%s", out)
+	}
+	if !strings.Contains(out, "width: 10px") {
+		t.Error("Expected configured cell width")
+	}
+}
+
+func TestEncodeHTMLEscapesFont(t *testing.T) {
+	t.Parallel()
+
+	blocks := [][]BlockRune{{{'▀', RGB{255, 0, 0}, RGB{}}}}
+	out := RenderToHTML(blocks, HTMLOptions{
+		FontFamily: `'Fira "Code"', x</style><script>alert(1)</script>, monospace`,
+	})
+	if strings.Contains(out, "<script>") {
+		t.Errorf("Font family should not inject markup, got:\n%s", out)
+	}
+	want := `font-family: "Fira \"Code\"", "x\3c /style>\3c script>alert(1)\3c /script>", monospace;`
+	if !strings.Contains(out, want) {
+		t.Errorf("Expected %s, got:\n%s", want, out)
+	}
+
+	var sb strings.Builder
+	err := EncodeHTML(&sb, blocks, HTMLOptions{FontSize: "1px;}</style>"})
+	if err == nil {
+		t.Error("Expected an error for an unsafe font size")
+	}
+}
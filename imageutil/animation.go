@@ -0,0 +1,82 @@
+package imageutil
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"io"
+	"os"
+	"time"
+)
+
+// defaultGIFDelay is used for frames with a zero delay, matching what
+// browsers do for such GIFs.
+const defaultGIFDelay = 100 * time.Millisecond
+
+// Animation is a decoded animated image. Every frame is fully composited,
+// so it can be rendered on its own.
+type Animation struct {
+	Frames []*RGBAImage
+	Delays []time.Duration
+}
+
+// LoadAnimation loads an animated GIF from the specified path.
+func LoadAnimation(path string) (*Animation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open animation: %w", err)
+	}
+	defer f.Close()
+	return DecodeAnimation(f)
+}
+
+// DecodeAnimation decodes an animated GIF, applying each frame's disposal
+// method so the returned frames are what a viewer would show. A still GIF
+// yields a single frame.
+func DecodeAnimation(r io.Reader) (*Animation, error) {
+	g, err := gif.DecodeAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode gif: %w", err)
+	}
+	if len(g.Image) == 0 {
+		return nil, fmt.Errorf("gif has no frames")
+	}
+
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if bounds.Empty() {
+		bounds = g.Image[0].Bounds()
+	}
+	canvas := image.NewRGBA(bounds)
+
+	anim := &Animation{}
+	for i, frame := range g.Image {
+		var previous *image.RGBA
+		disposal := byte(0)
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewRGBA(bounds)
+			copy(previous.Pix, canvas.Pix)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		anim.Frames = append(anim.Frames, RGBAImageFromImage(canvas))
+
+		delay := defaultGIFDelay
+		if i < len(g.Delay) && g.Delay[i] > 0 {
+			delay = time.Duration(g.Delay[i]) * 10 * time.Millisecond
+		}
+		anim.Delays = append(anim.Delays, delay)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent,
+				image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return anim, nil
+}
@@ -80,6 +80,19 @@ func (img *RGBAImage) Clone() *RGBAImage {
 	return clone
 }
 
+// Crop returns a copy of the part of img inside rect, clipped to the
+// image bounds.
+func Crop(img *RGBAImage, rect image.Rectangle) *RGBAImage {
+	rect = rect.Intersect(img.Bounds())
+	cropped := NewRGBAImage(rect.Dx(), rect.Dy())
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		start := img.PixOffset(rect.Min.X, y)
+		copy(cropped.Pix[cropped.PixOffset(0, y-rect.Min.Y):],
+			img.Pix[start:start+rect.Dx()*4])
+	}
+	return cropped
+}
+
 // GrayImage wraps image.Gray for single-channel images (e.g., edge maps).
 type GrayImage struct {
 	*image.Gray
@@ -1,9 +1,16 @@
 package imageutil
 
 import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewRGBAImage(t *testing.T) {
@@ -43,6 +50,24 @@ func TestRGBAImageClone(t *testing.T) {
 	}
 }
 
+func TestCrop(t *testing.T) {
+	img := NewRGBAImage(10, 8)
+	img.SetRGB(3, 2, RGB{R: 255})
+	img.SetRGB(9, 7, RGB{G: 255})
+
+	cropped := Crop(img, image.Rect(3, 2, 12, 10))
+	if cropped.Width() != 7 || cropped.Height() != 6 {
+		t.Fatalf("Expected 7x6 after clipping, got %dx%d",
+			cropped.Width(), cropped.Height())
+	}
+	if got := cropped.GetRGB(0, 0); got != (RGB{R: 255}) {
+		t.Errorf("Expected red at the origin, got %v", got)
+	}
+	if got := cropped.GetRGB(6, 5); got != (RGB{G: 255}) {
+		t.Errorf("Expected green at the corner, got %v", got)
+	}
+}
+
 func TestNewGrayImage(t *testing.T) {
 	img := NewGrayImage(100, 50)
 	if img.Width() != 100 {
@@ -193,6 +218,129 @@ func TestLoadSaveImage(t *testing.T) {
 	}
 }
 
+func TestY4MReader(t *testing.T) {
+	// Two 4x2 C420jpeg frames: mid-gray, then full-range white
+	var stream bytes.Buffer
+	stream.WriteString("YUV4MPEG2 W4 H2 F30000:1001 Ip A1:1 C420jpeg\n")
+	stream.WriteString("FRAME\n")
+	stream.Write(bytes.Repeat([]byte{126}, 8))
+	stream.Write(bytes.Repeat([]byte{128}, 4))
+	stream.WriteString("FRAME\n")
+	stream.Write(bytes.Repeat([]byte{235}, 8))
+	stream.Write(bytes.Repeat([]byte{128}, 4))
+
+	if !IsY4M(stream.Bytes()) {
+		t.Fatal("IsY4M should recognize the stream signature")
+	}
+	reader, err := NewY4MReader(&stream)
+	if err != nil {
+		t.Fatalf("Failed to parse header: %v", err)
+	}
+	if reader.Width() != 4 || reader.Height() != 2 {
+		t.Errorf("Expected 4x2, got %dx%d", reader.Width(), reader.Height())
+	}
+	if fps := reader.FrameRate(); fps < 29.96 || fps > 29.98 {
+		t.Errorf("Expected 29.97 fps, got %f", fps)
+	}
+
+	gray, err := reader.ReadFrame()
+	if err != nil {
+		t.Fatalf("Failed to read first frame: %v", err)
+	}
+	if c := gray.GetRGB(3, 1); c.R != c.G || c.G != c.B || c.R < 125 || c.R > 131 {
+		t.Errorf("Expected neutral mid-gray, got %v", c)
+	}
+
+	white, err := reader.ReadFrame()
+	if err != nil {
+		t.Fatalf("Failed to read second frame: %v", err)
+	}
+	if c := white.GetRGB(0, 0); c != (RGB{255, 255, 255}) {
+		t.Errorf("Expected white, got %v", c)
+	}
+
+	if _, err := reader.ReadFrame(); err != io.EOF {
+		t.Errorf("Expected io.EOF after last frame, got %v", err)
+	}
+}
+
+func TestY4MReaderRejectsHighBitDepth(t *testing.T) {
+	header := "YUV4MPEG2 W4 H2 F25:1 C420p10\n"
+	if _, err := NewY4MReader(strings.NewReader(header)); err == nil {
+		t.Error("Expected an error for a 10-bit 4:2:0 stream")
+	}
+}
+
+func TestRawRGBReader(t *testing.T) {
+	frame := []byte{
+		255, 0, 0, 0, 255, 0,
+		0, 0, 255, 10, 20, 30,
+	}
+	// One complete frame followed by a partial one
+	stream := bytes.NewReader(append(append([]byte{}, frame...), 1, 2, 3))
+
+	reader, err := NewRawRGBReader(stream, 2, 2, 24)
+	if err != nil {
+		t.Fatalf("Failed to create reader: %v", err)
+	}
+	img, err := reader.ReadFrame()
+	if err != nil {
+		t.Fatalf("Failed to read frame: %v", err)
+	}
+	if c := img.GetRGB(1, 1); c != (RGB{10, 20, 30}) {
+		t.Errorf("Expected (10,20,30), got %v", c)
+	}
+	if _, err := reader.ReadFrame(); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected io.ErrUnexpectedEOF for partial frame, got %v", err)
+	}
+
+	if _, err := NewRawRGBReader(stream, 0, 2, 24); err == nil {
+		t.Error("Expected error for missing frame size")
+	}
+}
+
+func TestDecodeAnimation(t *testing.T) {
+	palette := color.Palette{
+		color.RGBA{0, 0, 0, 255},
+		color.RGBA{255, 0, 0, 255},
+		color.RGBA{0, 0, 0, 0},
+	}
+	full := image.NewPaletted(image.Rect(0, 0, 4, 4), palette)
+	// Second frame only covers the top-left pixel, the rest must persist
+	patch := image.NewPaletted(image.Rect(0, 0, 1, 1), palette)
+	patch.SetColorIndex(0, 0, 1)
+
+	var buf bytes.Buffer
+	err := gif.EncodeAll(&buf, &gif.GIF{
+		Image:    []*image.Paletted{full, patch},
+		Delay:    []int{0, 25},
+		Disposal: []byte{gif.DisposalNone, gif.DisposalNone},
+		Config:   image.Config{ColorModel: palette, Width: 4, Height: 4},
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode gif: %v", err)
+	}
+
+	anim, err := DecodeAnimation(&buf)
+	if err != nil {
+		t.Fatalf("Failed to decode animation: %v", err)
+	}
+	if len(anim.Frames) != 2 {
+		t.Fatalf("Expected 2 frames, got %d", len(anim.Frames))
+	}
+	if anim.Delays[0] != defaultGIFDelay || anim.Delays[1] != 250*time.Millisecond {
+		t.Errorf("Unexpected delays: %v", anim.Delays)
+	}
+	second := anim.Frames[1]
+	if second.Width() != 4 || second.Height() != 4 {
+		t.Errorf("Frames should be full canvas size, got %dx%d",
+			second.Width(), second.Height())
+	}
+	if c := second.GetRGB(0, 0); c != (RGB{255, 0, 0}) {
+		t.Errorf("Expected red patch, got %v", c)
+	}
+}
+
 func TestCalculateMSE(t *testing.T) {
 	img1 := NewRGBAImage(10, 10)
 	img2 := NewRGBAImage(10, 10)
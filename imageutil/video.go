@@ -0,0 +1,265 @@
+package imageutil
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// FrameReader reads successive frames from an uncompressed video stream.
+// ReadFrame returns io.EOF once the stream is exhausted.
+type FrameReader interface {
+	// ReadFrame decodes the next frame.
+	ReadFrame() (*RGBAImage, error)
+	// Width returns the frame width in pixels.
+	Width() int
+	// Height returns the frame height in pixels.
+	Height() int
+	// FrameRate returns the nominal frame rate in frames per second.
+	FrameRate() float64
+}
+
+// y4mMagic is the signature that starts every YUV4MPEG2 stream.
+const y4mMagic = "YUV4MPEG2"
+
+// IsY4M reports whether header starts with the YUV4MPEG2 signature.
+func IsY4M(header []byte) bool {
+	return bytes.HasPrefix(header, []byte(y4mMagic))
+}
+
+// Y4MReader decodes a YUV4MPEG2 (y4m) stream, as produced by
+// `ffmpeg -f yuv4mpegpipe`. Only 8-bit 4:2:0, 4:2:2, 4:4:4 and mono
+// streams are supported.
+type Y4MReader struct {
+	r          *bufio.Reader
+	width      int
+	height     int
+	fpsNum     int
+	fpsDen     int
+	chromaW    int
+	chromaH    int
+	mono       bool
+	fullRange  bool
+	frameBytes []byte
+}
+
+// NewY4MReader parses the stream header and returns a reader positioned at
+// the first frame.
+func NewY4MReader(r io.Reader) (*Y4MReader, error) {
+	br := bufio.NewReader(r)
+	header, err := br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("failed to read y4m header: %w", err)
+	}
+	fields := strings.Fields(header)
+	if len(fields) == 0 || fields[0] != y4mMagic {
+		return nil, fmt.Errorf("not a y4m stream")
+	}
+
+	y := &Y4MReader{r: br, fpsNum: 25, fpsDen: 1}
+	colorspace := "420jpeg"
+	for _, field := range fields[1:] {
+		value := field[1:]
+		switch field[0] {
+		case 'W':
+			y.width, err = strconv.Atoi(value)
+		case 'H':
+			y.height, err = strconv.Atoi(value)
+		case 'F':
+			y.fpsNum, y.fpsDen, err = parseRatio(value)
+		case 'C':
+			colorspace = value
+		case 'X':
+			if strings.EqualFold(value, "COLORRANGE=FULL") {
+				y.fullRange = true
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid y4m header field %q: %w", field, err)
+		}
+	}
+	if y.width <= 0 || y.height <= 0 {
+		return nil, fmt.Errorf("y4m header has no frame size")
+	}
+	if y.fpsNum <= 0 || y.fpsDen <= 0 {
+		return nil, fmt.Errorf("invalid y4m frame rate %d:%d", y.fpsNum, y.fpsDen)
+	}
+
+	// High bit depth variants such as C420p10 store 16-bit samples and
+	// fall through to the error.
+	switch colorspace {
+	case "420", "420jpeg", "420paldv", "420mpeg2":
+		y.chromaW, y.chromaH = (y.width+1)/2, (y.height+1)/2
+	case "422":
+		y.chromaW, y.chromaH = (y.width+1)/2, y.height
+	case "444":
+		y.chromaW, y.chromaH = y.width, y.height
+	case "mono":
+		y.mono = true
+	default:
+		return nil, fmt.Errorf("unsupported y4m colorspace C%s", colorspace)
+	}
+
+	size := y.width * y.height
+	if !y.mono {
+		size += 2 * y.chromaW * y.chromaH
+	}
+	y.frameBytes = make([]byte, size)
+	return y, nil
+}
+
+// parseRatio parses a y4m "num:den" ratio.
+func parseRatio(s string) (int, int, error) {
+	num, den, found := strings.Cut(s, ":")
+	if !found {
+		return 0, 0, fmt.Errorf("expected num:den")
+	}
+	n, err := strconv.Atoi(num)
+	if err != nil {
+		return 0, 0, err
+	}
+	d, err := strconv.Atoi(den)
+	if err != nil {
+		return 0, 0, err
+	}
+	return n, d, nil
+}
+
+// Width returns the frame width in pixels.
+func (y *Y4MReader) Width() int { return y.width }
+
+// Height returns the frame height in pixels.
+func (y *Y4MReader) Height() int { return y.height }
+
+// FrameRate returns the frame rate declared in the stream header.
+func (y *Y4MReader) FrameRate() float64 {
+	return float64(y.fpsNum) / float64(y.fpsDen)
+}
+
+// ReadFrame reads and converts the next frame to RGB.
+func (y *Y4MReader) ReadFrame() (*RGBAImage, error) {
+	line, err := y.r.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read y4m frame header: %w", err)
+	}
+	if !strings.HasPrefix(line, "FRAME") {
+		return nil, fmt.Errorf("invalid y4m frame header %q", strings.TrimSpace(line))
+	}
+	if _, err := io.ReadFull(y.r, y.frameBytes); err != nil {
+		return nil, fmt.Errorf("truncated y4m frame: %w", err)
+	}
+
+	img := NewRGBAImage(y.width, y.height)
+	lumaSize := y.width * y.height
+	chromaSize := y.chromaW * y.chromaH
+	for py := 0; py < y.height; py++ {
+		for px := 0; px < y.width; px++ {
+			luma := y.frameBytes[py*y.width+px]
+			cb, cr := uint8(128), uint8(128)
+			if !y.mono {
+				cx := px * y.chromaW / y.width
+				cy := py * y.chromaH / y.height
+				idx := cy*y.chromaW + cx
+				cb = y.frameBytes[lumaSize+idx]
+				cr = y.frameBytes[lumaSize+chromaSize+idx]
+			}
+			img.SetRGB(px, py, yCbCrToRGB(luma, cb, cr, y.fullRange))
+		}
+	}
+	return img, nil
+}
+
+// yCbCrToRGB converts a BT.601 YCbCr sample to RGB. Limited range
+// (16-235 luma) is the y4m default; full range is used when the stream
+// declares XCOLORRANGE=FULL.
+func yCbCrToRGB(luma, cb, cr uint8, fullRange bool) RGB {
+	yf := float64(luma)
+	scale := 1.0
+	if !fullRange {
+		yf -= 16
+		scale = 255.0 / 219.0
+	}
+	u := float64(cb) - 128
+	v := float64(cr) - 128
+	if !fullRange {
+		u *= 255.0 / 224.0
+		v *= 255.0 / 224.0
+	}
+	yf *= scale
+	return RGB{
+		R: clampByte(yf + 1.402*v),
+		G: clampByte(yf - 0.344136*u - 0.714136*v),
+		B: clampByte(yf + 1.772*u),
+	}
+}
+
+// clampByte rounds v and clamps it to the 0-255 range.
+func clampByte(v float64) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
+
+// RawRGBReader reads a headerless stream of packed RGB24 frames, as
+// produced by `ffmpeg -f rawvideo -pix_fmt rgb24`. Since the stream has no
+// header, the frame size and rate must be supplied by the caller.
+type RawRGBReader struct {
+	r          io.Reader
+	width      int
+	height     int
+	fps        float64
+	frameBytes []byte
+}
+
+// NewRawRGBReader creates a reader for width x height RGB24 frames at the
+// given frame rate.
+func NewRawRGBReader(r io.Reader, width, height int, fps float64) (*RawRGBReader, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("raw RGB stream needs a frame size, got %dx%d", width, height)
+	}
+	if fps <= 0 {
+		return nil, fmt.Errorf("raw RGB stream needs a positive frame rate, got %v", fps)
+	}
+	return &RawRGBReader{
+		r:          r,
+		width:      width,
+		height:     height,
+		fps:        fps,
+		frameBytes: make([]byte, width*height*3),
+	}, nil
+}
+
+// Width returns the frame width in pixels.
+func (rr *RawRGBReader) Width() int { return rr.width }
+
+// Height returns the frame height in pixels.
+func (rr *RawRGBReader) Height() int { return rr.height }
+
+// FrameRate returns the frame rate given to NewRawRGBReader.
+func (rr *RawRGBReader) FrameRate() float64 { return rr.fps }
+
+// ReadFrame reads the next frame. A partial trailing frame is reported as
+// io.ErrUnexpectedEOF.
+func (rr *RawRGBReader) ReadFrame() (*RGBAImage, error) {
+	if _, err := io.ReadFull(rr.r, rr.frameBytes); err != nil {
+		return nil, err
+	}
+	img := NewRGBAImage(rr.width, rr.height)
+	for i := 0; i < rr.width*rr.height; i++ {
+		img.Pix[i*4] = rr.frameBytes[i*3]
+		img.Pix[i*4+1] = rr.frameBytes[i*3+1]
+		img.Pix[i*4+2] = rr.frameBytes[i*3+2]
+		img.Pix[i*4+3] = 255
+	}
+	return img, nil
+}
@@ -1,10 +1,14 @@
 package img2ansi
 
 import (
+	"context"
 	"fmt"
+	"image"
 	_ "image/jpeg"
 	_ "image/png"
+	"io"
 	"math"
+	"os"
 	"time"
 
 	"github.com/wbrown/img2ansi/imageutil"
@@ -66,11 +70,74 @@ type Quadrants struct {
 // algorithm to an image operating on 2x2 blocks rather than pixels. The
 // function takes an input image and a binary image with edges detected. It
 // returns a BlockRune representation with the dithering algorithm applied,
-// with colors quantized to the nearest ANSI color.
+// with colors quantized to the nearest ANSI color. With a RateLambda above
+// zero, blocks are chosen to balance their error against the bytes needed
+// to encode them. With AdaptiveColors set, the palette is first derived
+// from img.
 func (r *Renderer) BrownDitherForBlocks(
 	img *imageutil.RGBAImage,
 	edges *imageutil.GrayImage,
 ) [][]BlockRune {
+	blocks, _ := r.BrownDitherForBlocksContext(context.Background(), img, edges)
+	return blocks
+}
+
+// BrownDitherForBlocksContext is BrownDitherForBlocks with cancellation.
+// It checks ctx after each row of blocks and, once it is done, stops and
+// returns the rows finished so far with the context's error.
+func (r *Renderer) BrownDitherForBlocksContext(
+	ctx context.Context,
+	img *imageutil.RGBAImage,
+	edges *imageutil.GrayImage,
+) ([][]BlockRune, error) {
+	monitor := r.newRenderMonitor(ctx)
+	r.adaptPalette(img)
+	return r.ditherBlockRows(img, edges, r.chooser(r.RateLambda),
+		monitor.nextPass(img.Height()/2))
+}
+
+// chooser returns the blockChooser for a rate-distortion lambda: the
+// most accurate block for zero, or rateChooser above it.
+func (r *Renderer) chooser(lambda float64) blockChooser {
+	if lambda > 0 {
+		return r.rateChooser(lambda)
+	}
+	return func(_, _ int, block [4]RGB, isEdge bool) (rune, RGB, RGB) {
+		return r.FindBestBlockRepresentation(block, isEdge)
+	}
+}
+
+// blockChooser selects the rune and colors for the 2x2 block at block
+// coordinates (bx, by). The block colors already include any error
+// diffused from previously processed blocks.
+type blockChooser func(bx, by int, block [4]RGB, isEdge bool) (rune, RGB, RGB)
+
+// ditherBlocks walks the image in 2x2 blocks, asks choose for the
+// representation of each block, and diffuses the resulting error into the
+// unprocessed neighbors. It is the shared core of BrownDitherForBlocks and
+// the stateful renderers built on top of it.
+func (r *Renderer) ditherBlocks(
+	img *imageutil.RGBAImage,
+	edges *imageutil.GrayImage,
+	choose blockChooser,
+) [][]BlockRune {
+	result, _ := r.ditherBlockRows(img, edges, choose, nil)
+	return result
+}
+
+// rowHandler receives each row of blocks as soon as it is final. Error
+// only diffuses to later rows, so a row doesn't change once the next one
+// starts. Returning an error stops dithering.
+type rowHandler func(by int, row []BlockRune) error
+
+// ditherBlockRows is ditherBlocks with a handler called after each row.
+// It returns the rows completed so far with the handler's error, if any.
+func (r *Renderer) ditherBlockRows(
+	img *imageutil.RGBAImage,
+	edges *imageutil.GrayImage,
+	choose blockChooser,
+	onRow rowHandler,
+) ([][]BlockRune, error) {
 	height, width := img.Height(), img.Width()
 	blockHeight, blockWidth := height/2, width/2
 	result := make([][]BlockRune, blockHeight)
@@ -95,8 +162,7 @@ func (r *Renderer) BrownDitherForBlocks(
 				edges.GrayAt(bx*2+1, by*2+1).Y > 128
 
 			// Find the best representation for this block
-			bestRune, fgColor, bgColor := r.FindBestBlockRepresentation(
-				block, isEdge)
+			bestRune, fgColor, bgColor := choose(bx, by, block, isEdge)
 
 			// Store the result
 			result[by][bx] = BlockRune{
@@ -122,9 +188,15 @@ func (r *Renderer) BrownDitherForBlocks(
 				distributeError(img, y, x, colorError, isEdge)
 			}
 		}
+
+		if onRow != nil {
+			if err := onRow(by, result[by]); err != nil {
+				return result[:by+1], err
+			}
+		}
 	}
 
-	return result
+	return result, nil
 }
 
 // FindBestBlockRepresentation finds the optimal (rune, fg, bg) for a 2x2 pixel block.
@@ -150,24 +222,7 @@ func (r *Renderer) BrownDitherForBlocks(
 // Results are cached by the palette-mapped block key for reuse.
 func (r *Renderer) FindBestBlockRepresentation(block [4]RGB, isEdge bool) (rune, RGB, RGB) {
 	// Map each color in the block to its closest palette color
-	var fgPaletteBlock [4]RGB
-	var bgPaletteBlock [4]RGB
-
-	// Use precomputed tables if available, otherwise use KD-tree lookup
-	useKdTreeLookup := r.fgClosestColor == nil || r.bgClosestColor == nil
-	for i, color := range block {
-		if useKdTreeLookup {
-			// Runtime KD-tree lookup for custom ColorDistanceMethod
-			fgPaletteBlock[i], _ = r.fgTree.nearestNeighbor(
-				color, r.fgTree.Color, math.MaxFloat64, 0, r.ColorMethod)
-			bgPaletteBlock[i], _ = r.bgTree.nearestNeighbor(
-				color, r.bgTree.Color, math.MaxFloat64, 0, r.ColorMethod)
-		} else {
-			// Fast table lookup for built-in methods
-			fgPaletteBlock[i] = (*r.fgClosestColor)[color.toUint32()]
-			bgPaletteBlock[i] = (*r.bgClosestColor)[color.toUint32()]
-		}
-	}
+	fgPaletteBlock, bgPaletteBlock := r.closestPaletteColors(block)
 	blockKey := rgbsPairToUint256(fgPaletteBlock, bgPaletteBlock)
 
 	// Check the block cache for a match
@@ -256,6 +311,27 @@ func (r *Renderer) FindBestBlockRepresentation(block [4]RGB, isEdge bool) (rune,
 	return bestRune, bestFG, bestBG
 }
 
+// closestPaletteColors maps each color in block to its closest foreground
+// and background palette colors.
+func (r *Renderer) closestPaletteColors(block [4]RGB) (fg, bg [4]RGB) {
+	// Use precomputed tables if available, otherwise use KD-tree lookup
+	useKdTreeLookup := r.fgClosestColor == nil || r.bgClosestColor == nil
+	for i, color := range block {
+		if useKdTreeLookup {
+			// Runtime KD-tree lookup for custom ColorDistanceMethod
+			fg[i], _ = r.fgTree.nearestNeighbor(
+				color, r.fgTree.Color, math.MaxFloat64, 0, r.ColorMethod)
+			bg[i], _ = r.bgTree.nearestNeighbor(
+				color, r.bgTree.Color, math.MaxFloat64, 0, r.ColorMethod)
+		} else {
+			// Fast table lookup for built-in methods
+			fg[i] = (*r.fgClosestColor)[color.toUint32()]
+			bg[i] = (*r.bgClosestColor)[color.toUint32()]
+		}
+	}
+	return fg, bg
+}
+
 // calculateBlockError calculates the error between a 2x2 block of colors
 // and a given representation of a block. The function takes the block of
 // colors, the quadrants of the block representation, the foreground and
@@ -332,50 +408,118 @@ func distributeError(img *imageutil.RGBAImage, y, x int, error RGBError, isEdge
 }
 
 // ImageToANSI converts an image to ANSI art. The function takes the path to
-// an image file as a string and returns the image as an ANSI string.
+// an image file as a string and returns the image as an ANSI string,
+// compressed with CompressBlocks. The image is fitted with RenderToBudget
+// so that the string is at most MaxChars bytes. An error from the
+// DebugSink is printed to stderr rather than returned.
 func (r *Renderer) ImageToANSI(imagePath string) (string, error) {
 	img, err := imageutil.LoadImage(imagePath)
 	if err != nil {
 		return "", fmt.Errorf("could not read image from %s: %v", imagePath, err)
 	}
 
-	aspectRatio := float64(img.Width()) / float64(img.Height())
-	width := r.TargetWidth
-	height := int(float64(width) / aspectRatio / r.ScaleFactor)
+	result, err := r.render(context.Background(), img)
+	if err != nil {
+		return "", err
+	}
+	if result.DebugErr != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: debug images: %v\n", result.DebugErr)
+	}
+	return result.ANSI, nil
+}
 
-	for {
-		resized, edges := imageutil.PrepareForANSI(img, width, height)
-		ditheredImg := r.BrownDitherForBlocks(resized, edges)
+// RenderResult is an image rendered by RenderImage or RenderReader.
+type RenderResult struct {
+	Blocks [][]BlockRune
+	ANSI   string // Blocks compressed with CompressBlocks
+	Width  int    // width in characters
+	Height int    // height in lines
+	Stats  RenderStats
+	// DebugErr is the error the DebugSink returned, if any. A failing
+	// sink doesn't fail the render.
+	DebugErr error
+}
 
-		// Write the scaled image to a file for debugging
-		if err := imageutil.SavePNG(resized.RGBA, "resized.png"); err != nil {
-			fmt.Println(err)
-		}
+// RenderStats describes the work done for one render.
+type RenderStats struct {
+	Duration      time.Duration // total time, including resizing
+	BestBlockTime time.Duration // time spent choosing blocks
+	CacheHits     int
+	CacheMisses   int
+	// RateLambda is the rate-distortion lambda needed to fit MaxChars, or
+	// zero if the image fit as it was.
+	RateLambda float64
+}
 
-		// Write the dithered image to a file for debugging
-		if err := saveBlocksToPNG(ditheredImg,
-			"dithered.png",
-			len(ditheredImg[0])*8,
-			int(float64(len(ditheredImg)*8)*r.ScaleFactor),
-			r.ScaleFactor,
-		); err != nil {
-			fmt.Println(err)
-		}
+// RenderImage renders img as ANSI art, fitted like ImageToANSI so that
+// its compressed form is at most MaxChars bytes.
+func (r *Renderer) RenderImage(img image.Image) (*RenderResult, error) {
+	return r.RenderImageContext(context.Background(), img)
+}
 
-		// Write the edges image to a file for debugging
-		if err := imageutil.SaveGrayImage(edges, "edges.png"); err != nil {
-			fmt.Println(err)
-		}
+// RenderImageContext is RenderImage with cancellation. It stops between
+// rows of blocks once ctx is done and returns the context's error.
+func (r *Renderer) RenderImageContext(
+	ctx context.Context,
+	img image.Image,
+) (*RenderResult, error) {
+	rgba, ok := img.(*imageutil.RGBAImage)
+	if !ok {
+		rgba = imageutil.RGBAImageFromImage(img)
+	}
+	return r.render(ctx, rgba)
+}
 
-		ansiImage := r.RenderToAnsi(ditheredImg)
-		if len(ansiImage) <= r.MaxChars {
-			return ansiImage, nil
-		}
+// RenderReader decodes an image in any format imageutil.LoadImage
+// supports from rd and renders it like RenderImage.
+func (r *Renderer) RenderReader(rd io.Reader) (*RenderResult, error) {
+	return r.RenderReaderContext(context.Background(), rd)
+}
 
-		width -= 2
-		height = int(float64(width) / aspectRatio / 2)
-		if width < 10 {
-			return "", fmt.Errorf("image too large to fit within character limit")
-		}
+// RenderReaderContext is RenderReader with cancellation, like
+// RenderImageContext.
+func (r *Renderer) RenderReaderContext(
+	ctx context.Context,
+	rd io.Reader,
+) (*RenderResult, error) {
+	img, _, err := image.Decode(rd)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode image: %w", err)
+	}
+	return r.RenderImageContext(ctx, img)
+}
+
+// render fits img into MaxChars, sends the intermediate images to the
+// debug sink and collects the stats of the render. An error from the
+// debug sink is kept in the result rather than returned.
+func (r *Renderer) render(
+	ctx context.Context,
+	img *imageutil.RGBAImage,
+) (*RenderResult, error) {
+	start := time.Now()
+	hits, misses, blockTime := r.lookupHits, r.lookupMisses, r.bestBlockTime
+
+	fit, err := r.RenderToBudgetContext(ctx, img, r.MaxChars)
+	if err != nil {
+		return nil, err
+	}
+	debugErr := r.debugImages(fit.Resized, fit.Edges, fit.Blocks)
+
+	result := &RenderResult{
+		Blocks:   fit.Blocks,
+		ANSI:     fit.ANSI,
+		Height:   len(fit.Blocks),
+		DebugErr: debugErr,
+		Stats: RenderStats{
+			Duration:      time.Since(start),
+			BestBlockTime: r.bestBlockTime - blockTime,
+			CacheHits:     r.lookupHits - hits,
+			CacheMisses:   r.lookupMisses - misses,
+			RateLambda:    fit.Lambda,
+		},
+	}
+	if len(fit.Blocks) > 0 {
+		result.Width = len(fit.Blocks[0])
 	}
+	return result, nil
 }
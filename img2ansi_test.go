@@ -0,0 +1,111 @@
+package img2ansi
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wbrown/img2ansi/imageutil"
+)
+
+// gradientImage returns a standard library image with a color gradient.
+func gradientImage(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{
+				R: uint8(x * 255 / width), G: uint8(y * 255 / height),
+				B: 0x80, A: 0xFF,
+			})
+		}
+	}
+	return img
+}
+
+func TestRenderImage(t *testing.T) {
+	t.Parallel()
+
+	r := NewRenderer(WithPalette("ansi16"), WithTargetWidth(20))
+	result, err := r.RenderImage(gradientImage(80, 40))
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	// 80x40 at 20 columns with a 2.0 scale factor is 5 lines
+	if result.Width != 20 || result.Height != 5 {
+		t.Errorf("Expected 20x5, got %dx%d", result.Width, result.Height)
+	}
+	if len(result.Blocks) != result.Height || len(result.Blocks[0]) != result.Width {
+		t.Errorf("Blocks are %dx%d, want %dx%d", len(result.Blocks[0]),
+			len(result.Blocks), result.Width, result.Height)
+	}
+	if result.ANSI != r.CompressBlocks(result.Blocks) {
+		t.Error("ANSI doesn't match the compressed blocks")
+	}
+	if n := result.Stats.CacheHits + result.Stats.CacheMisses; n != 100 {
+		t.Errorf("Expected 100 block lookups, got %d", n)
+	}
+	if result.Stats.RateLambda != 0 {
+		t.Errorf("Expected no lambda, got %v", result.Stats.RateLambda)
+	}
+
+	r.MaxChars = len(result.ANSI) / 2
+	fitted, err := r.RenderImage(gradientImage(80, 40))
+	if err != nil {
+		t.Fatalf("Failed to fit: %v", err)
+	}
+	if len(fitted.ANSI) > r.MaxChars {
+		t.Errorf("Output of %d bytes exceeds MaxChars %d", len(fitted.ANSI), r.MaxChars)
+	}
+}
+
+func TestRenderReader(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, gradientImage(80, 40)); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	r := NewRenderer(WithPalette("ansi16"), WithTargetWidth(20))
+	result, err := r.RenderReader(&buf)
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	expected, err := r.RenderImage(gradientImage(80, 40))
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	if result.ANSI != expected.ANSI {
+		t.Error("Decoded image renders differently from the original")
+	}
+
+	if _, err := r.RenderReader(strings.NewReader("not an image")); err == nil {
+		t.Error("Expected an error for undecodable input")
+	}
+}
+
+func TestImageToANSIFitsMaxChars(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "input.png")
+	if err := imageutil.SavePNG(gradientImage(80, 40), path); err != nil {
+		t.Fatalf("Failed to write input: %v", err)
+	}
+	r := NewRenderer(WithPalette("ansi16"), WithTargetWidth(20))
+	full, err := r.ImageToANSI(path)
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+
+	r.MaxChars = len(full) / 2
+	fitted, err := r.ImageToANSI(path)
+	if err != nil {
+		t.Fatalf("Failed to fit: %v", err)
+	}
+	if len(fitted) > r.MaxChars {
+		t.Errorf("Output of %d bytes exceeds MaxChars %d", len(fitted), r.MaxChars)
+	}
+}
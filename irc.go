@@ -0,0 +1,209 @@
+package img2ansi
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// mircColors are the RGB values of the mIRC color numbers. The first 16
+// are the classic palette; 16 to 98 are the extended colors supported by
+// modern clients. See https://modern.ircdocs.horse/formatting.html.
+var mircColors = [99]RGB{
+	{0xFF, 0xFF, 0xFF}, {0x00, 0x00, 0x00}, {0x00, 0x00, 0x7F}, {0x00, 0x93, 0x00},
+	{0xFF, 0x00, 0x00}, {0x7F, 0x00, 0x00}, {0x9C, 0x00, 0x9C}, {0xFC, 0x7F, 0x00},
+	{0xFF, 0xFF, 0x00}, {0x00, 0xFC, 0x00}, {0x00, 0x93, 0x93}, {0x00, 0xFF, 0xFF},
+	{0x00, 0x00, 0xFC}, {0xFF, 0x00, 0xFF}, {0x7F, 0x7F, 0x7F}, {0xD2, 0xD2, 0xD2},
+	{0x47, 0x00, 0x00}, {0x47, 0x21, 0x00}, {0x47, 0x47, 0x00}, {0x32, 0x47, 0x00},
+	{0x00, 0x47, 0x00}, {0x00, 0x47, 0x2C}, {0x00, 0x47, 0x47}, {0x00, 0x27, 0x47},
+	{0x00, 0x00, 0x47}, {0x2E, 0x00, 0x47}, {0x47, 0x00, 0x47}, {0x47, 0x00, 0x2A},
+	{0x74, 0x00, 0x00}, {0x74, 0x3A, 0x00}, {0x74, 0x74, 0x00}, {0x51, 0x74, 0x00},
+	{0x00, 0x74, 0x00}, {0x00, 0x74, 0x49}, {0x00, 0x74, 0x74}, {0x00, 0x40, 0x74},
+	{0x00, 0x00, 0x74}, {0x4B, 0x00, 0x74}, {0x74, 0x00, 0x74}, {0x74, 0x00, 0x45},
+	{0xB5, 0x00, 0x00}, {0xB5, 0x63, 0x00}, {0xB5, 0xB5, 0x00}, {0x7D, 0xB5, 0x00},
+	{0x00, 0xB5, 0x00}, {0x00, 0xB5, 0x71}, {0x00, 0xB5, 0xB5}, {0x00, 0x63, 0xB5},
+	{0x00, 0x00, 0xB5}, {0x75, 0x00, 0xB5}, {0xB5, 0x00, 0xB5}, {0xB5, 0x00, 0x6B},
+	{0xFF, 0x00, 0x00}, {0xFF, 0x8C, 0x00}, {0xFF, 0xFF, 0x00}, {0xB2, 0xFF, 0x00},
+	{0x00, 0xFF, 0x00}, {0x00, 0xFF, 0xA0}, {0x00, 0xFF, 0xFF}, {0x00, 0x8C, 0xFF},
+	{0x00, 0x00, 0xFF}, {0xA5, 0x00, 0xFF}, {0xFF, 0x00, 0xFF}, {0xFF, 0x00, 0x98},
+	{0xFF, 0x59, 0x59}, {0xFF, 0xB4, 0x59}, {0xFF, 0xFF, 0x71}, {0xCF, 0xFF, 0x60},
+	{0x6F, 0xFF, 0x6F}, {0x65, 0xFF, 0xC9}, {0x6D, 0xFF, 0xFF}, {0x59, 0xB4, 0xFF},
+	{0x59, 0x59, 0xFF}, {0xC4, 0x59, 0xFF}, {0xFF, 0x66, 0xFF}, {0xFF, 0x59, 0xBC},
+	{0xFF, 0x9C, 0x9C}, {0xFF, 0xD3, 0x9C}, {0xFF, 0xFF, 0x9C}, {0xE2, 0xFF, 0x9C},
+	{0x9C, 0xFF, 0x9C}, {0x9C, 0xFF, 0xDB}, {0x9C, 0xFF, 0xFF}, {0x9C, 0xD3, 0xFF},
+	{0x9C, 0x9C, 0xFF}, {0xDC, 0x9C, 0xFF}, {0xFF, 0x9C, 0xFF}, {0xFF, 0x94, 0xD3},
+	{0x00, 0x00, 0x00}, {0x13, 0x13, 0x13}, {0x28, 0x28, 0x28}, {0x36, 0x36, 0x36},
+	{0x4D, 0x4D, 0x4D}, {0x65, 0x65, 0x65}, {0x81, 0x81, 0x81}, {0x9F, 0x9F, 0x9F},
+	{0xBC, 0xBC, 0xBC}, {0xE2, 0xE2, 0xE2}, {0xFF, 0xFF, 0xFF},
+}
+
+// IRCOptions controls the text produced by EncodeIRC.
+type IRCOptions struct {
+	// Colors is the number of mIRC colors to use, 16 or 99. Colors outside
+	// of the set are mapped to the nearest one, so blocks rendered with
+	// the mirc16 or mirc99 palette keep their exact colors.
+	Colors int
+	// MaxLineBytes is the longest line EncodeIRC writes, in bytes and
+	// without the line ending. IRC servers cap a whole message at 512
+	// bytes, including the command, target and the sender's prefix that
+	// the server adds, so the default of 400 leaves room for those.
+	MaxLineBytes int
+	// SplitLines continues rows that don't fit in MaxLineBytes on the next
+	// line. Without it EncodeIRC returns an error for such rows, since a
+	// split row no longer lines up with the rest of the image.
+	SplitLines bool
+}
+
+// DefaultIRCOptions returns the options used when fields are left zero.
+func DefaultIRCOptions() IRCOptions {
+	return IRCOptions{
+		Colors:       16,
+		MaxLineBytes: 400,
+	}
+}
+
+// withDefaults fills zero fields from DefaultIRCOptions.
+func (o IRCOptions) withDefaults() IRCOptions {
+	d := DefaultIRCOptions()
+	if o.Colors <= 0 {
+		o.Colors = d.Colors
+	}
+	if o.MaxLineBytes <= 0 {
+		o.MaxLineBytes = d.MaxLineBytes
+	}
+	return o
+}
+
+// ircEncoder maps block colors to mIRC color numbers.
+type ircEncoder struct {
+	colors  []RGB
+	indices map[RGB]int
+}
+
+// newIRCEncoder returns an encoder for the first n mIRC colors. Colors
+// that appear more than once map to their lowest number, which older
+// clients are more likely to support.
+func newIRCEncoder(n int) *ircEncoder {
+	n = min(n, len(mircColors))
+	e := &ircEncoder{colors: mircColors[:n], indices: make(map[RGB]int, n)}
+	for i := n - 1; i >= 0; i-- {
+		e.indices[e.colors[i]] = i
+	}
+	return e
+}
+
+// index returns the mIRC color number closest to c.
+func (e *ircEncoder) index(c RGB) int {
+	if idx, ok := e.indices[c]; ok {
+		return idx
+	}
+	best, bestDistance := 0, math.MaxFloat64
+	for i, p := range e.colors {
+		if d := (RGBMethod{}).Distance(c, p); d < bestDistance {
+			best, bestDistance = i, d
+		}
+	}
+	e.indices[c] = best
+	return best
+}
+
+// ircState tracks the colors set so far on the current line; -1 means
+// the color hasn't been set.
+type ircState struct {
+	fg, bg int
+}
+
+// cell returns the control code and text that draw block in state s, and
+// updates s. As in CompressANSI, a space only needs its background and a
+// full block only its foreground, so a solid cell is drawn with whichever
+// of the two already has its color, and changes only the foreground
+// otherwise since that is the shorter code.
+func (s *ircState) cell(e *ircEncoder, block BlockRune) (string, string) {
+	text := string(block.Rune)
+	if block.Rune == ' ' || block.Rune == '█' {
+		solid := block.BG
+		if block.Rune == '█' {
+			solid = block.FG
+		}
+		idx := e.index(solid)
+		switch idx {
+		case s.bg:
+			return "", " "
+		case s.fg:
+			return "", "█"
+		}
+		if s.bg < 0 {
+			s.fg, s.bg = idx, idx
+			return fmt.Sprintf("\x03%02d,%02d", idx, idx), " "
+		}
+		s.fg = idx
+		return fmt.Sprintf("\x03%02d", idx), "█"
+	}
+
+	fg, bg := e.index(block.FG), e.index(block.BG)
+	var code string
+	switch {
+	case bg != s.bg:
+		code = fmt.Sprintf("\x03%02d,%02d", fg, bg)
+	case fg != s.fg:
+		code = fmt.Sprintf("\x03%02d", fg)
+	}
+	s.fg, s.bg = fg, bg
+	return code, text
+}
+
+// EncodeIRC writes blocks as lines of text with mIRC color codes, ready
+// to be sent as IRC messages one line at a time. Color codes are only
+// written where the colors change, and always with two digits so they
+// can't run into the text that follows.
+//
+// Each line starts with no colors set, as every IRC message does. Rows
+// longer than opts.MaxLineBytes are split over several lines when
+// opts.SplitLines is set, and reported as an error otherwise.
+func EncodeIRC(w io.Writer, blocks [][]BlockRune, opts IRCOptions) error {
+	if len(blocks) == 0 {
+		return fmt.Errorf("cannot encode an empty block grid")
+	}
+	opts = opts.withDefaults()
+	e := newIRCEncoder(opts.Colors)
+	bw := bufio.NewWriter(w)
+
+	for y, row := range blocks {
+		var line strings.Builder
+		state := ircState{fg: -1, bg: -1}
+		for x, block := range row {
+			code, text := state.cell(e, block)
+			if line.Len()+len(code)+len(text) > opts.MaxLineBytes {
+				if !opts.SplitLines {
+					return fmt.Errorf(
+						"row %d exceeds %d bytes at column %d",
+						y, opts.MaxLineBytes, x)
+				}
+				if line.Len() == 0 {
+					return fmt.Errorf(
+						"a single cell doesn't fit in %d bytes",
+						opts.MaxLineBytes)
+				}
+				bw.WriteString(line.String())
+				bw.WriteByte('\n')
+				line.Reset()
+				state = ircState{fg: -1, bg: -1}
+				code, text = state.cell(e, block)
+			}
+			line.WriteString(code)
+			line.WriteString(text)
+		}
+		bw.WriteString(line.String())
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// RenderToIRC renders blocks to mIRC formatted text.
+func RenderToIRC(blocks [][]BlockRune, opts IRCOptions) (string, error) {
+	var sb strings.Builder
+	err := EncodeIRC(&sb, blocks, opts)
+	return sb.String(), err
+}
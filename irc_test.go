@@ -0,0 +1,78 @@
+package img2ansi
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncodeIRC(t *testing.T) {
+	t.Parallel()
+
+	white, black := RGB{0xFF, 0xFF, 0xFF}, RGB{0, 0, 0}
+	red, navy := RGB{0xFF, 0, 0}, RGB{0, 0, 0x7F}
+	blocks := [][]BlockRune{
+		{
+			{' ', red, black},  // black background
+			{'▀', red, black},  // red on black
+			{'▀', red, black},  // same colors, no code
+			{'█', red, white},  // red is already the foreground
+			{' ', navy, black}, // black is already the background
+			{'▄', white, navy}, // new background needs both colors
+		},
+		{
+			{'█', RGB{0xF0, 0x10, 0x10}, black}, // nearest mIRC color is red
+		},
+	}
+
+	out, err := RenderToIRC(blocks, IRCOptions{})
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	expected := "\x0301,01 \x0304▀▀█ \x0300,02▄\n" +
+		"\x0304,04 \n"
+	if out != expected {
+		t.Errorf("Unexpected output:\n got %q\nwant %q", out, expected)
+	}
+
+	if _, err := RenderToIRC(nil, IRCOptions{}); err == nil {
+		t.Error("Expected error for empty grid")
+	}
+}
+
+func TestEncodeIRCLineLimit(t *testing.T) {
+	t.Parallel()
+
+	row := make([]BlockRune, 10)
+	for i := range row {
+		row[i] = BlockRune{'▀', mircColors[i%2+2], mircColors[1]}
+	}
+	blocks := [][]BlockRune{row}
+
+	// Every cell is a 3 byte code plus a 3 byte glyph, after the first
+	// cell's 6 byte code.
+	if _, err := RenderToIRC(blocks, IRCOptions{MaxLineBytes: 30}); err == nil {
+		t.Error("Expected error for a row over the limit")
+	}
+
+	out, err := RenderToIRC(blocks, IRCOptions{MaxLineBytes: 30, SplitLines: true})
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 lines, got %d: %q", len(lines), out)
+	}
+	cells := 0
+	for _, line := range lines {
+		if len(line) > 30 {
+			t.Errorf("Line %q is %d bytes, over the limit", line, len(line))
+		}
+		if !strings.HasPrefix(line, "\x03") || line[3] != ',' {
+			t.Errorf("Line %q should start by setting both colors", line)
+		}
+		cells += strings.Count(line, "▀")
+	}
+	if cells != len(row) {
+		t.Errorf("Expected %d cells over all lines, got %d", len(row), cells)
+	}
+}
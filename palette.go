@@ -1,7 +1,12 @@
 package img2ansi
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
 	"embed"
+	"encoding/gob"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -15,10 +20,43 @@ import (
 //go:embed colordata/ansi16.palette
 //go:embed colordata/ansi256.json
 //go:embed colordata/ansi256.palette
+//go:embed colordata/campbell.json
+//go:embed colordata/campbell.palette
+//go:embed colordata/dracula.json
+//go:embed colordata/dracula.palette
+//go:embed colordata/gruvbox-dark.json
+//go:embed colordata/gruvbox-dark.palette
+//go:embed colordata/gruvbox-light.json
+//go:embed colordata/gruvbox-light.palette
 //go:embed colordata/jetbrains32.json
 //go:embed colordata/jetbrains32.palette
+//go:embed colordata/macos-terminal.json
+//go:embed colordata/macos-terminal.palette
+//go:embed colordata/mirc16.json
+//go:embed colordata/mirc16.palette
+//go:embed colordata/mirc99.json
+//go:embed colordata/mirc99.palette
+//go:embed colordata/nord.json
+//go:embed colordata/nord.palette
+//go:embed colordata/solarized.json
+//go:embed colordata/solarized.palette
+//go:embed colordata/tango.json
+//go:embed colordata/tango.palette
+//go:embed colordata/xterm.json
+//go:embed colordata/xterm.palette
 var f embed.FS
 
+// paletteAliases are other names the embedded palettes are known by.
+// Solarized's light and dark variants share their 16 ANSI colors and
+// differ only in the default foreground and background, which palettes
+// don't include, so both names load the same palette.
+var paletteAliases = map[string]string{
+	"vga":             "ansi16",
+	"gruvbox":         "gruvbox-dark",
+	"solarized-dark":  "solarized",
+	"solarized-light": "solarized",
+}
+
 // ByAnsiCode implements sort.Interface for AnsiData based on the numeric
 // value of the ANSI code
 type ByAnsiCode AnsiData
@@ -66,6 +104,9 @@ func parseAnsiCodeForSort(code string) int {
 // background AnsiData slices, or an error if the file cannot be read or
 // the data cannot be unmarshalled.
 func ReadAnsiDataFromJSON(filename string) (AnsiData, AnsiData, error) {
+	if name, ok := paletteAliases[filename]; ok {
+		filename = name
+	}
 	var data []byte
 	// First, try the VFS.
 	template := "colordata/%s.json"
@@ -197,6 +238,61 @@ func ComputeTablesForKdSearch(colorData AnsiData) ComputedTables {
 	}
 }
 
+// approximateTableBits is the bits per channel of the grid
+// ComputeApproximateTables finds nearest colors on.
+const approximateTableBits = 5
+
+// ComputeApproximateTables computes the same tables as ComputeTables, but
+// finds the nearest palette color only for the center of each cell of a
+// 32x32x32 grid over the RGB cube and uses it for the whole cell. Colors
+// near the border between two palette colors may map to the other one,
+// but the tables take a fraction of a second to build, which suits
+// palettes made for a single image.
+func ComputeApproximateTables(colorData AnsiData, method ColorDistanceMethod) ComputedTables {
+	colorTable := make(map[RGB]uint32)
+	colorArr := make([]RGB, len(colorData))
+	for idx, entry := range colorData {
+		colorArr[idx] = rgbFromUint32(entry.Key)
+		colorTable[rgbFromUint32(entry.Key)] = uint32(idx)
+	}
+	maxDepth := int(math.Log2(float64(len(colorArr))) + 1)
+	kdTree := buildKDTree(colorArr, 0, maxDepth)
+
+	const cells = 1 << approximateTableBits
+	const shift = 8 - approximateTableBits
+	var grid [cells * cells * cells]RGB
+	for r := 0; r < cells; r++ {
+		for g := 0; g < cells; g++ {
+			for b := 0; b < cells; b++ {
+				center := RGB{
+					uint8(r<<shift | 1<<(shift-1)),
+					uint8(g<<shift | 1<<(shift-1)),
+					uint8(b<<shift | 1<<(shift-1)),
+				}
+				best, bestDist := colorArr[0], math.MaxFloat64
+				for _, c := range colorArr {
+					if d := method.Distance(center, c); d < bestDist {
+						best, bestDist = c, d
+					}
+				}
+				grid[(r*cells+g)*cells+b] = best
+			}
+		}
+	}
+
+	closestColorArr := make([]RGB, 256*256*256)
+	for i := range closestColorArr {
+		r, g, b := i>>16>>shift, i>>8&0xff>>shift, i&0xff>>shift
+		closestColorArr[i] = grid[(r*cells+g)*cells+b]
+	}
+	return ComputedTables{
+		ColorArr:        &colorArr,
+		ClosestColorArr: &closestColorArr,
+		ColorTable:      &colorTable,
+		KdTree:          kdTree,
+	}
+}
+
 type ColorTableEntry struct {
 	Color RGB
 	Index uint32
@@ -259,6 +355,14 @@ func LoadPaletteAsCompactTables(path string, method ColorDistanceMethod) (Compac
 	if err != nil {
 		return CompactComputedTables{}, CompactComputedTables{}, err
 	}
+	pair := compactTablePair(fgData, bgData, method)
+	return pair.Fg, pair.Bg, nil
+}
+
+// compactTablePair computes the compact tables for foreground and
+// background palettes, leaving the background's empty if it has the same
+// colors.
+func compactTablePair(fgData, bgData AnsiData, method ColorDistanceMethod) CompactTablePair {
 	fgComputedTable := CompactComputeTables(fgData, method)
 	fgComputedTable.AnsiData = fgData
 
@@ -270,7 +374,48 @@ func LoadPaletteAsCompactTables(path string, method ColorDistanceMethod) (Compac
 			AnsiData: bgData,
 		}
 	}
-	return fgComputedTable, bgComputedTable, nil
+	return CompactTablePair{Fg: fgComputedTable, Bg: bgComputedTable}
+}
+
+// paletteHash returns a hex digest identifying the colors and codes of
+// foreground and background palettes, used to name cached tables.
+func paletteHash(fgData, bgData AnsiData) string {
+	h := sha256.New()
+	for _, data := range []AnsiData{fgData, bgData} {
+		for _, entry := range data {
+			fmt.Fprintf(h, "%s=%06x\n", entry.Value, entry.Key)
+		}
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+// decodePaletteTables decodes the gzipped gob tables of a .palette file.
+func decodePaletteTables(data []byte) (ColorMethodCompactTables, error) {
+	gzr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gzip reader: %v", err)
+	}
+	defer gzr.Close()
+
+	var cmct ColorMethodCompactTables
+	if err := gob.NewDecoder(gzr).Decode(&cmct); err != nil {
+		return nil, fmt.Errorf("failed to decode palette data: %v", err)
+	}
+	return cmct, nil
+}
+
+// encodePaletteTables encodes tables in the format of .palette files.
+func encodePaletteTables(cmct ColorMethodCompactTables) ([]byte, error) {
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	if err := gob.NewEncoder(gzw).Encode(cmct); err != nil {
+		return nil, fmt.Errorf("failed to encode palette data: %v", err)
+	}
+	if err := gzw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
 
 func PaletteSame(fgData AnsiData, bgData AnsiData) bool {
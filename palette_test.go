@@ -194,3 +194,43 @@ func TestSerialization(t *testing.T) {
 		}
 	}
 }
+
+func TestEmbeddedThemes(t *testing.T) {
+	t.Parallel()
+
+	// Color 1, red, of each theme
+	themes := map[string]RGB{
+		"campbell":        {0xC5, 0x0F, 0x1F},
+		"dracula":         {0xFF, 0x55, 0x55},
+		"gruvbox":         {0xCC, 0x24, 0x1D},
+		"gruvbox-dark":    {0xCC, 0x24, 0x1D},
+		"gruvbox-light":   {0xCC, 0x24, 0x1D},
+		"macos-terminal":  {0x99, 0x00, 0x00},
+		"nord":            {0xBF, 0x61, 0x6A},
+		"solarized-dark":  {0xDC, 0x32, 0x2F},
+		"solarized-light": {0xDC, 0x32, 0x2F},
+		"tango":           {0xCC, 0x00, 0x00},
+		"vga":             {0xAA, 0x00, 0x00},
+		"xterm":           {0xCD, 0x00, 0x00},
+	}
+	for name, red := range themes {
+		r := NewRenderer()
+		if err := r.LoadPalette(name); err != nil {
+			t.Errorf("%s: failed to load: %v", name, err)
+			continue
+		}
+		if !r.UsingPrecomputedTables() {
+			t.Errorf("%s: expected precomputed tables", name)
+		}
+		if len(r.fgAnsiRev) != 16 || len(r.bgAnsiRev) != 16 {
+			t.Errorf("%s: expected 16 colors, got %d and %d",
+				name, len(r.fgAnsiRev), len(r.bgAnsiRev))
+		}
+		if got := rgbFromUint32(r.fgAnsiRev["31"]); got != red {
+			t.Errorf("%s: expected red %v, got %v", name, red, got)
+		}
+		if got := rgbFromUint32(r.bgAnsiRev["41"]); got != red {
+			t.Errorf("%s: expected background red %v, got %v", name, red, got)
+		}
+	}
+}
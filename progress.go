@@ -0,0 +1,60 @@
+package img2ansi
+
+import (
+	"context"
+	"time"
+)
+
+// Progress reports how far a render has got. It is passed to the
+// callback set with WithProgress after each row of blocks.
+type Progress struct {
+	// Pass counts the times the image has been dithered in this render,
+	// starting at 1. Fitting output into MaxChars can take several.
+	Pass int
+	// Rows is the number of block rows done in this pass, out of
+	// TotalRows.
+	Rows      int
+	TotalRows int
+	// CacheHitRate is the Renderer's block cache hit rate so far.
+	CacheHitRate float64
+	// Elapsed is the time since the render started.
+	Elapsed time.Duration
+}
+
+// ProgressFunc receives progress reports of a render.
+type ProgressFunc func(Progress)
+
+// renderMonitor stops the dithering passes of one render when its context
+// is done, and reports their progress to the Renderer's callback.
+type renderMonitor struct {
+	r     *Renderer
+	ctx   context.Context
+	start time.Time
+	pass  int
+}
+
+// newRenderMonitor returns a monitor for a render starting now.
+func (r *Renderer) newRenderMonitor(ctx context.Context) *renderMonitor {
+	return &renderMonitor{r: r, ctx: ctx, start: time.Now()}
+}
+
+// nextPass returns the rowHandler for the next dithering pass, over
+// totalRows rows of blocks. It returns the context's error once it is
+// done, which stops the pass.
+func (m *renderMonitor) nextPass(totalRows int) rowHandler {
+	m.pass++
+	pass := m.pass
+	return func(by int, _ []BlockRune) error {
+		if m.r.Progress != nil {
+			_, _, hitRate := m.r.CacheStats()
+			m.r.Progress(Progress{
+				Pass:         pass,
+				Rows:         by + 1,
+				TotalRows:    totalRows,
+				CacheHitRate: hitRate,
+				Elapsed:      time.Since(m.start),
+			})
+		}
+		return m.ctx.Err()
+	}
+}
@@ -0,0 +1,66 @@
+package img2ansi
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/wbrown/img2ansi/imageutil"
+)
+
+func TestProgress(t *testing.T) {
+	t.Parallel()
+
+	var reports []Progress
+	r := NewRenderer(WithPalette("ansi16"), WithProgress(func(p Progress) {
+		reports = append(reports, p)
+	}))
+	r.BrownDitherForBlocks(noiseImage(8, 6), imageutil.NewGrayImage(8, 6))
+	if len(reports) != 3 {
+		t.Fatalf("Expected 3 reports, got %d", len(reports))
+	}
+	for i, p := range reports {
+		if p.Pass != 1 || p.Rows != i+1 || p.TotalRows != 3 {
+			t.Errorf("Report %d = %+v, want pass 1 row %d of 3", i, p, i+1)
+		}
+	}
+
+	// Fitting a small budget takes several passes
+	reports = nil
+	r.TargetWidth = 16
+	if _, err := r.RenderToBudget(noiseImage(32, 32), 600); err != nil {
+		t.Fatalf("Failed to fit: %v", err)
+	}
+	last := reports[len(reports)-1]
+	if last.Pass < 2 {
+		t.Errorf("Expected several passes, got %d", last.Pass)
+	}
+	if last.Rows != last.TotalRows {
+		t.Errorf("Expected the last pass to finish, got row %d of %d",
+			last.Rows, last.TotalRows)
+	}
+}
+
+func TestRenderCancellation(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := NewRenderer(WithPalette("ansi16"), WithProgress(func(p Progress) {
+		if p.Rows == 2 {
+			cancel()
+		}
+	}))
+	blocks, err := r.BrownDitherForBlocksContext(ctx,
+		noiseImage(16, 16), imageutil.NewGrayImage(16, 16))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if len(blocks) != 2 {
+		t.Errorf("Expected dithering to stop after 2 rows, got %d", len(blocks))
+	}
+
+	r = NewRenderer(WithPalette("ansi16"), WithTargetWidth(16))
+	if _, err := r.RenderImageContext(ctx, noiseImage(32, 32)); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,348 @@
+package img2ansi
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/wbrown/img2ansi/imageutil"
+)
+
+// QuantizeMethod selects how an adaptive palette is derived from an image.
+type QuantizeMethod int
+
+const (
+	// QuantizeKMeans refines a median cut palette with k-means
+	// clustering. It is the slowest and most accurate.
+	QuantizeKMeans QuantizeMethod = iota
+	// QuantizeMedianCut splits the image's colors into boxes at the
+	// median of their widest channel, using the mean of each box.
+	QuantizeMedianCut
+	// QuantizeOctree merges the least used branches of an octree of the
+	// image's colors.
+	QuantizeOctree
+)
+
+// maxQuantizeSamples caps how many pixels of an image are sampled to
+// derive a palette, which is plenty to find its colors.
+const maxQuantizeSamples = 1 << 16
+
+// kMeansIterations caps the refinement passes of QuantizeKMeans.
+const kMeansIterations = 10
+
+// QuantizePalette derives a palette of at most n colors that represents
+// img well, for rendering it with an adaptive palette. Images with fewer
+// distinct colors get fewer.
+func QuantizePalette(img *imageutil.RGBAImage, n int, method QuantizeMethod) []RGB {
+	samples := sampleColors(img)
+	if n <= 0 || len(samples) == 0 {
+		return nil
+	}
+	var palette []RGB
+	switch method {
+	case QuantizeMedianCut:
+		palette = medianCut(samples, n)
+	case QuantizeOctree:
+		palette = octreePalette(samples, n)
+	default:
+		palette = kMeans(samples, medianCut(samples, n))
+	}
+	return uniqueColors(palette)
+}
+
+// TrueColorAnsiData returns foreground and background palettes for
+// colors using 24-bit 38;2;r;g;b and 48;2;r;g;b codes.
+func TrueColorAnsiData(colors []RGB) (AnsiData, AnsiData) {
+	fg := make(AnsiData, 0, len(colors))
+	bg := make(AnsiData, 0, len(colors))
+	for _, c := range colors {
+		fg = append(fg, AnsiEntry{Key: c.toUint32(),
+			Value: fmt.Sprintf("38;2;%d;%d;%d", c.R, c.G, c.B)})
+		bg = append(bg, AnsiEntry{Key: c.toUint32(),
+			Value: fmt.Sprintf("48;2;%d;%d;%d", c.R, c.G, c.B)})
+	}
+	sort.Sort(ByAnsiCode(fg))
+	sort.Sort(ByAnsiCode(bg))
+	return fg, bg
+}
+
+// adaptPalette switches the Renderer to a palette of AdaptiveColors
+// colors derived from img, if it is set. The palette's tables are the
+// approximate ones ComputeApproximateTables makes, which are quick enough
+// to build for every image. Rendering the same colors again reuses them.
+// The palette stays loaded after the render.
+func (r *Renderer) adaptPalette(img *imageutil.RGBAImage) {
+	if r.AdaptiveColors <= 0 {
+		return
+	}
+	colors := QuantizePalette(img, r.AdaptiveColors, r.AdaptiveMethod)
+	if len(colors) == 0 {
+		return
+	}
+	fgData, bgData := TrueColorAnsiData(colors)
+	name := "adaptive-" + paletteHash(fgData, bgData)
+	if r.paletteLoaded && r.palettePath == name {
+		return
+	}
+	fgTables := ComputeApproximateTables(fgData, r.ColorMethod)
+	fgTables.AnsiData = fgData
+	// The background has the same colors, so it shares the lookup tables
+	bgTables := fgTables
+	bgTables.AnsiData = bgData
+	r.usePalette(name, &fgTables, &bgTables)
+}
+
+// sampleColors returns the colors of img's pixels, taken on a grid that
+// keeps them to about maxQuantizeSamples.
+func sampleColors(img *imageutil.RGBAImage) []RGB {
+	w, h := img.Width(), img.Height()
+	step := max(1, int(math.Ceil(math.Sqrt(float64(w*h)/maxQuantizeSamples))))
+	samples := make([]RGB, 0, (w/step+1)*(h/step+1))
+	for y := 0; y < h; y += step {
+		for x := 0; x < w; x += step {
+			samples = append(samples, rgbFromImageutil(img.GetRGB(x, y)))
+		}
+	}
+	return samples
+}
+
+// uniqueColors returns colors without duplicates, in their first order.
+func uniqueColors(colors []RGB) []RGB {
+	seen := make(map[RGB]bool, len(colors))
+	unique := colors[:0]
+	for _, c := range colors {
+		if !seen[c] {
+			seen[c] = true
+			unique = append(unique, c)
+		}
+	}
+	return unique
+}
+
+// channel returns component i, 0 to 2, of c.
+func channel(c RGB, i int) uint8 {
+	switch i {
+	case 0:
+		return c.R
+	case 1:
+		return c.G
+	}
+	return c.B
+}
+
+// meanColor returns the average of colors.
+func meanColor(colors []RGB) RGB {
+	var sum [3]int
+	for _, c := range colors {
+		sum[0] += int(c.R)
+		sum[1] += int(c.G)
+		sum[2] += int(c.B)
+	}
+	n := len(colors)
+	return RGB{uint8((sum[0] + n/2) / n), uint8((sum[1] + n/2) / n),
+		uint8((sum[2] + n/2) / n)}
+}
+
+// colorBox is a set of colors that median cut splits.
+type colorBox struct {
+	colors []RGB
+	// widest is the channel with the largest range, and span its range
+	widest int
+	span   int
+}
+
+// newColorBox returns the box holding colors.
+func newColorBox(colors []RGB) colorBox {
+	box := colorBox{colors: colors}
+	for i := 0; i < 3; i++ {
+		lo, hi := 255, 0
+		for _, c := range colors {
+			v := int(channel(c, i))
+			lo, hi = min(lo, v), max(hi, v)
+		}
+		if hi-lo > box.span {
+			box.widest, box.span = i, hi-lo
+		}
+	}
+	return box
+}
+
+// medianCut splits samples into at most n boxes, always splitting the box
+// with the widest range at the median of that channel, and returns the
+// boxes' mean colors.
+func medianCut(samples []RGB, n int) []RGB {
+	boxes := []colorBox{newColorBox(append([]RGB(nil), samples...))}
+	for len(boxes) < n {
+		best := -1
+		for i, box := range boxes {
+			if len(box.colors) > 1 && box.span > 0 &&
+				(best < 0 || box.span > boxes[best].span) {
+				best = i
+			}
+		}
+		if best < 0 {
+			break
+		}
+		box := boxes[best]
+		sort.Slice(box.colors, func(i, j int) bool {
+			return channel(box.colors[i], box.widest) < channel(box.colors[j], box.widest)
+		})
+		mid := len(box.colors) / 2
+		boxes[best] = newColorBox(box.colors[:mid])
+		boxes = append(boxes, newColorBox(box.colors[mid:]))
+	}
+
+	palette := make([]RGB, len(boxes))
+	for i, box := range boxes {
+		palette[i] = meanColor(box.colors)
+	}
+	return palette
+}
+
+// kMeans refines the centers of a palette by k-means clustering of the
+// samples, assigning each to its nearest center and moving the centers to
+// the means of their samples, until they settle. A center left without
+// samples keeps its place.
+func kMeans(samples []RGB, centers []RGB) []RGB {
+	centers = append([]RGB(nil), centers...)
+	assigned := make([]int, len(samples))
+	for iter := 0; iter < kMeansIterations; iter++ {
+		sums := make([][4]int, len(centers))
+		for i, s := range samples {
+			best, bestDist := 0, math.MaxInt
+			for j, c := range centers {
+				dr := int(s.R) - int(c.R)
+				dg := int(s.G) - int(c.G)
+				db := int(s.B) - int(c.B)
+				if d := dr*dr + dg*dg + db*db; d < bestDist {
+					best, bestDist = j, d
+				}
+			}
+			assigned[i] = best
+			sums[best][0] += int(s.R)
+			sums[best][1] += int(s.G)
+			sums[best][2] += int(s.B)
+			sums[best][3]++
+		}
+
+		moved := false
+		for j, sum := range sums {
+			n := sum[3]
+			if n == 0 {
+				continue
+			}
+			c := RGB{uint8((sum[0] + n/2) / n), uint8((sum[1] + n/2) / n),
+				uint8((sum[2] + n/2) / n)}
+			if c != centers[j] {
+				centers[j], moved = c, true
+			}
+		}
+		if !moved {
+			break
+		}
+	}
+	return centers
+}
+
+// octreeNode is a node of the color octree. Leaves hold the sum and count
+// of the colors that reached them.
+type octreeNode struct {
+	sum      [3]int
+	count    int
+	children [8]*octreeNode
+	leaf     bool
+}
+
+// octreeDepth is the depth of the octree's leaves, one level per bit of
+// the color components.
+const octreeDepth = 8
+
+// octreePalette builds an octree of the samples and merges the leaves of
+// its least used deepest branches until at most n leaves remain, which
+// become the palette.
+func octreePalette(samples []RGB, n int) []RGB {
+	root := &octreeNode{}
+	// reducible holds the inner nodes at each level
+	var reducible [octreeDepth][]*octreeNode
+	leaves := 0
+	for _, c := range samples {
+		node := root
+		for level := 0; level < octreeDepth; level++ {
+			shift := 7 - level
+			idx := int(c.R>>shift&1)<<2 | int(c.G>>shift&1)<<1 | int(c.B>>shift&1)
+			child := node.children[idx]
+			if child == nil {
+				child = &octreeNode{leaf: level == octreeDepth-1}
+				node.children[idx] = child
+				if child.leaf {
+					leaves++
+				} else {
+					reducible[level+1] = append(reducible[level+1], child)
+				}
+			}
+			node = child
+		}
+		node.sum[0] += int(c.R)
+		node.sum[1] += int(c.G)
+		node.sum[2] += int(c.B)
+		node.count++
+	}
+	reducible[0] = []*octreeNode{root}
+
+	// Merge the deepest branches first, so their children are leaves
+	for level := octreeDepth - 1; level >= 0 && leaves > n; level-- {
+		nodes := reducible[level]
+		for _, node := range nodes {
+			for _, child := range node.children {
+				if child != nil {
+					node.count += child.count
+				}
+			}
+		}
+		sort.SliceStable(nodes, func(i, j int) bool {
+			return nodes[i].count < nodes[j].count
+		})
+		for _, node := range nodes {
+			if leaves <= n {
+				break
+			}
+			merged := 0
+			node.count = 0
+			for i, child := range node.children {
+				if child == nil {
+					continue
+				}
+				for k := range node.sum {
+					node.sum[k] += child.sum[k]
+				}
+				node.count += child.count
+				node.children[i] = nil
+				merged++
+			}
+			node.leaf = true
+			leaves -= merged - 1
+		}
+	}
+
+	var palette []RGB
+	var collect func(node *octreeNode)
+	collect = func(node *octreeNode) {
+		if node.leaf {
+			if node.count > 0 {
+				palette = append(palette, RGB{
+					uint8((node.sum[0] + node.count/2) / node.count),
+					uint8((node.sum[1] + node.count/2) / node.count),
+					uint8((node.sum[2] + node.count/2) / node.count),
+				})
+			}
+			return
+		}
+		for _, child := range node.children {
+			if child != nil {
+				collect(child)
+			}
+		}
+	}
+	collect(root)
+	return palette
+}
@@ -0,0 +1,222 @@
+package img2ansi
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/wbrown/img2ansi/imageutil"
+)
+
+// quadrantImage returns an image with a flat color in each quarter.
+func quadrantImage(width, height int, colors [4]RGB) *imageutil.RGBAImage {
+	img := imageutil.NewRGBAImage(width, height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := 0
+			if x >= width/2 {
+				i++
+			}
+			if y >= height/2 {
+				i += 2
+			}
+			img.SetRGB(x, y, colors[i].toImageutil())
+		}
+	}
+	return img
+}
+
+func TestQuantizePalette(t *testing.T) {
+	t.Parallel()
+
+	colors := [4]RGB{{200, 30, 30}, {20, 180, 60}, {40, 40, 220}, {250, 250, 240}}
+	img := quadrantImage(40, 40, colors)
+	methods := map[string]QuantizeMethod{
+		"kmeans":     QuantizeKMeans,
+		"median-cut": QuantizeMedianCut,
+		"octree":     QuantizeOctree,
+	}
+	for name, method := range methods {
+		// Flat colors are found exactly, and no more than there are
+		palette := QuantizePalette(img, 8, method)
+		if len(palette) != 4 {
+			t.Errorf("%s: expected 4 colors, got %v", name, palette)
+			continue
+		}
+		found := make(map[RGB]bool)
+		for _, c := range palette {
+			found[c] = true
+		}
+		for _, c := range colors {
+			if !found[c] {
+				t.Errorf("%s: expected %v in %v", name, c, palette)
+			}
+		}
+
+		// Busier images get at most n colors
+		palette = QuantizePalette(noiseImage(64, 64), 16, method)
+		if len(palette) == 0 || len(palette) > 16 {
+			t.Errorf("%s: expected up to 16 colors, got %d", name, len(palette))
+		}
+	}
+}
+
+func TestKMeansImprovesMedianCut(t *testing.T) {
+	t.Parallel()
+
+	img := noiseImage(64, 64)
+	samples := sampleColors(img)
+	sqErr := func(palette []RGB) float64 {
+		total := 0.0
+		for _, s := range samples {
+			best := math.MaxFloat64
+			for _, c := range palette {
+				dr := float64(s.R) - float64(c.R)
+				dg := float64(s.G) - float64(c.G)
+				db := float64(s.B) - float64(c.B)
+				best = math.Min(best, dr*dr+dg*dg+db*db)
+			}
+			total += best
+		}
+		return total
+	}
+	mc := QuantizePalette(img, 8, QuantizeMedianCut)
+	km := QuantizePalette(img, 8, QuantizeKMeans)
+	if sqErr(km) > sqErr(mc) {
+		t.Errorf("Expected k-means error %.0f to be at most median cut's %.0f",
+			sqErr(km), sqErr(mc))
+	}
+}
+
+func TestTrueColorAnsiData(t *testing.T) {
+	t.Parallel()
+
+	fg, bg := TrueColorAnsiData([]RGB{{255, 0, 16}, {1, 2, 3}})
+	if len(fg) != 2 || len(bg) != 2 {
+		t.Fatalf("Expected 2 colors, got %d and %d", len(fg), len(bg))
+	}
+	if fg[0].Value != "38;2;1;2;3" || fg[1].Value != "38;2;255;0;16" {
+		t.Errorf("Unexpected foreground codes %v", fg)
+	}
+	if bg[1].Value != "48;2;255;0;16" || bg[1].Key != 0xFF0010 {
+		t.Errorf("Unexpected background entry %v", bg[1])
+	}
+}
+
+func TestComputeApproximateTables(t *testing.T) {
+	t.Parallel()
+
+	palette := []RGB{{0, 0, 0}, {255, 0, 0}, {0, 200, 80}, {250, 250, 250}}
+	fg, _ := TrueColorAnsiData(palette)
+	method := RGBMethod{}
+	tables := ComputeApproximateTables(fg, method)
+	closest := *tables.ClosestColorArr
+
+	exact := func(c RGB) RGB {
+		best, bestDist := palette[0], math.MaxFloat64
+		for _, p := range palette {
+			if d := method.Distance(c, p); d < bestDist {
+				best, bestDist = p, d
+			}
+		}
+		return best
+	}
+	// Palette colors and cell centers map exactly; everything maps to
+	// palette colors
+	for _, c := range append(palette, RGB{4, 4, 4}, RGB{132, 100, 36}) {
+		if got := closest[c.toUint32()]; got != exact(c) {
+			t.Errorf("Closest to %v is %v, expected %v", c, got, exact(c))
+		}
+	}
+	inPalette := make(map[RGB]bool)
+	for _, c := range palette {
+		inPalette[c] = true
+	}
+	for i := 0; i < len(closest); i += 4099 {
+		if !inPalette[closest[i]] {
+			t.Fatalf("Color %06x maps to %v, not a palette color", i, closest[i])
+		}
+	}
+}
+
+func TestAdaptivePaletteRender(t *testing.T) {
+	t.Parallel()
+
+	colors := [4]RGB{{200, 30, 30}, {20, 180, 60}, {40, 40, 220}, {250, 250, 240}}
+	r := NewRenderer(WithPalette("ansi16"), WithTargetWidth(20),
+		WithAdaptivePalette(4, QuantizeKMeans))
+	result, err := r.RenderImage(quadrantImage(80, 80, colors))
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	if !strings.HasPrefix(r.palettePath, "adaptive-") {
+		t.Errorf("Expected an adaptive palette, got %q", r.palettePath)
+	}
+	if !strings.Contains(result.ANSI, "38;2;") && !strings.Contains(result.ANSI, "48;2;") {
+		t.Error("Expected 24-bit color codes in the output")
+	}
+
+	// The exact colors are in the palette, so blocks use only them
+	allowed := make(map[RGB]bool)
+	for _, c := range colors {
+		allowed[c] = true
+	}
+	for _, row := range result.Blocks {
+		for _, block := range row {
+			if !allowed[block.FG] || !allowed[block.BG] {
+				t.Fatalf("Block colors %v/%v aren't the image's", block.FG, block.BG)
+			}
+		}
+	}
+
+	// Rendering the same image keeps the palette, and its block cache
+	if _, err := r.RenderImage(quadrantImage(80, 80, colors)); err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	if hits, _, _ := r.CacheStats(); hits == 0 {
+		t.Error("Expected block cache hits on the second render")
+	}
+}
+
+func TestAdaptivePaletteBackground(t *testing.T) {
+	t.Parallel()
+
+	r := NewRenderer(WithPalette("ansi16"), WithTargetWidth(20),
+		WithAdaptivePalette(8, QuantizeMedianCut))
+	result, err := r.RenderImage(noiseImage(80, 60))
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	if r.bgClosestColor == nil {
+		t.Fatal("Expected lookup tables for the background")
+	}
+	if !strings.Contains(result.ANSI, "48;2;") {
+		t.Error("Expected 24-bit background codes in the output")
+	}
+
+	// Backgrounds are matched to the adaptive palette's 24-bit codes
+	for _, row := range result.Blocks {
+		for _, block := range row {
+			bg := block.BG
+			code, ok := r.bgAnsi.Get(bg.toUint32())
+			if want := fmt.Sprintf("48;2;%d;%d;%d", bg.R, bg.G, bg.B); !ok || code != want {
+				t.Fatalf("Background %v has code %v, expected %s", bg, code, want)
+			}
+			if (*r.bgClosestColor)[bg.toUint32()] != bg {
+				t.Fatalf("Background %v doesn't map to itself", bg)
+			}
+		}
+	}
+
+	// The Renderer keeps the adaptive palette until another is loaded
+	if !strings.HasPrefix(r.palettePath, "adaptive-") {
+		t.Errorf("Expected the adaptive palette to stay loaded, got %q", r.palettePath)
+	}
+	if err := r.LoadPalette("ansi16"); err != nil {
+		t.Fatalf("Failed to load palette: %v", err)
+	}
+	if _, ok := r.bgAnsi.Get((RGB{0xAA, 0, 0}).toUint32()); !ok {
+		t.Error("Expected LoadPalette to go back to ansi16")
+	}
+}
@@ -0,0 +1,141 @@
+package img2ansi
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/inconsolata"
+	"golang.org/x/image/math/fixed"
+)
+
+// RasterOptions controls how Rasterize draws a block grid.
+type RasterOptions struct {
+	// CellWidth and CellHeight are the terminal cell size in pixels.
+	CellWidth  int
+	CellHeight int
+	// LineGap is the number of pixels between rows. Terminals with extra
+	// line spacing show the background through these gaps.
+	LineGap int
+	// Background is the terminal background color shown in line gaps.
+	Background RGB
+	// Face draws characters that aren't block elements. It defaults to
+	// the embedded Inconsolata 8x16 bitmap font.
+	Face font.Face
+}
+
+// DefaultRasterOptions returns the options used when fields are left zero:
+// 8x16 cells with no line gap on a black background.
+func DefaultRasterOptions() RasterOptions {
+	return RasterOptions{
+		CellWidth:  8,
+		CellHeight: 16,
+		Face:       inconsolata.Regular8x16,
+	}
+}
+
+// withDefaults fills zero fields from DefaultRasterOptions.
+func (o RasterOptions) withDefaults() RasterOptions {
+	d := DefaultRasterOptions()
+	if o.CellWidth <= 0 {
+		o.CellWidth = d.CellWidth
+	}
+	if o.CellHeight <= 0 {
+		o.CellHeight = d.CellHeight
+	}
+	if o.Face == nil {
+		o.Face = d.Face
+	}
+	return o
+}
+
+// Rasterize draws blocks the way a terminal displays them. Block elements
+// are drawn geometrically to fill their cell, as terminals do, with the
+// quadrant split at half the cell width and height. Any other character
+// is drawn with the font face in the foreground color over the background
+// color.
+func Rasterize(blocks [][]BlockRune, opts RasterOptions) *image.RGBA {
+	opts = opts.withDefaults()
+	cols := 0
+	for _, row := range blocks {
+		cols = max(cols, len(row))
+	}
+	rowPitch := opts.CellHeight + opts.LineGap
+	height := len(blocks)*rowPitch - opts.LineGap
+	img := image.NewRGBA(image.Rect(0, 0, cols*opts.CellWidth, max(height, 0)))
+	draw.Draw(img, img.Bounds(),
+		image.NewUniform(opts.Background.toImageutil().ToColor()),
+		image.Point{}, draw.Src)
+
+	metrics := opts.Face.Metrics()
+	glyphHeight := (metrics.Ascent + metrics.Descent).Ceil()
+	baseline := (opts.CellHeight-glyphHeight)/2 + metrics.Ascent.Ceil()
+
+	for y, row := range blocks {
+		for x, block := range row {
+			cell := image.Rect(x*opts.CellWidth, y*rowPitch,
+				(x+1)*opts.CellWidth, y*rowPitch+opts.CellHeight)
+			if idx := blockIndex(block.Rune); Blocks[idx].Rune == block.Rune {
+				drawQuadrants(img, cell, Blocks[idx].Quad, block.FG, block.BG)
+				continue
+			}
+
+			fillRect(img, cell, block.BG)
+			advance, ok := opts.Face.GlyphAdvance(block.Rune)
+			if !ok {
+				continue
+			}
+			offset := (fixed.I(opts.CellWidth) - advance) / 2
+			d := font.Drawer{
+				Dst:  img,
+				Src:  image.NewUniform(block.FG.toImageutil().ToColor()),
+				Face: opts.Face,
+				Dot: fixed.Point26_6{
+					X: fixed.I(cell.Min.X) + offset,
+					Y: fixed.I(cell.Min.Y + baseline),
+				},
+			}
+			d.DrawString(string(block.Rune))
+		}
+	}
+	return img
+}
+
+// drawQuadrants fills a cell according to a block element's quadrants.
+func drawQuadrants(img *image.RGBA, cell image.Rectangle, quad Quadrants, fg, bg RGB) {
+	midX := cell.Min.X + cell.Dx()/2
+	midY := cell.Min.Y + cell.Dy()/2
+	quadrants := [4]struct {
+		rect   image.Rectangle
+		active bool
+	}{
+		{image.Rect(cell.Min.X, cell.Min.Y, midX, midY), quad.TopLeft},
+		{image.Rect(midX, cell.Min.Y, cell.Max.X, midY), quad.TopRight},
+		{image.Rect(cell.Min.X, midY, midX, cell.Max.Y), quad.BottomLeft},
+		{image.Rect(midX, midY, cell.Max.X, cell.Max.Y), quad.BottomRight},
+	}
+	for _, q := range quadrants {
+		if q.active {
+			fillRect(img, q.rect, fg)
+		} else {
+			fillRect(img, q.rect, bg)
+		}
+	}
+}
+
+// fillRect paints rect with a solid color.
+func fillRect(img *image.RGBA, rect image.Rectangle, c RGB) {
+	draw.Draw(img, rect, image.NewUniform(c.toImageutil().ToColor()),
+		image.Point{}, draw.Src)
+}
+
+// EncodePNG rasterizes blocks and writes them as a PNG image.
+func EncodePNG(w io.Writer, blocks [][]BlockRune, opts RasterOptions) error {
+	if len(blocks) == 0 {
+		return fmt.Errorf("cannot rasterize an empty block grid")
+	}
+	return png.Encode(w, Rasterize(blocks, opts))
+}
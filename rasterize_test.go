@@ -0,0 +1,60 @@
+package img2ansi
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+)
+
+func TestRasterize(t *testing.T) {
+	t.Parallel()
+
+	red, blue, gray := RGB{255, 0, 0}, RGB{0, 0, 255}, RGB{40, 40, 40}
+	blocks := [][]BlockRune{
+		{{'▀', red, blue}, {'A', red, blue}},
+		{{'▗', red, blue}, {' ', red, blue}},
+	}
+	img := Rasterize(blocks, RasterOptions{LineGap: 2, Background: gray})
+
+	if w, h := img.Bounds().Dx(), img.Bounds().Dy(); w != 16 || h != 34 {
+		t.Fatalf("Expected 16x34 image for 2x2 cells with 2px gap, got %dx%d", w, h)
+	}
+
+	at := func(x, y int) RGB {
+		c := img.RGBAAt(x, y)
+		return RGB{c.R, c.G, c.B}
+	}
+	if at(3, 7) != red || at(3, 8) != blue {
+		t.Error("Upper half block should split at half the cell height")
+	}
+	if at(0, 16) != gray || at(15, 17) != gray {
+		t.Error("Line gap should show the terminal background")
+	}
+	if at(3, 33) != blue || at(4, 33) != red || at(4, 25) != blue {
+		t.Error("Lower right quadrant should be drawn in the foreground color")
+	}
+
+	glyphPixels := 0
+	for y := 0; y < 16; y++ {
+		for x := 8; x < 16; x++ {
+			if at(x, y) != blue {
+				glyphPixels++
+			}
+		}
+	}
+	if glyphPixels == 0 {
+		t.Error("Expected the font to draw the 'A' glyph")
+	}
+
+	var buf bytes.Buffer
+	if err := EncodePNG(&buf, blocks, RasterOptions{}); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	decoded, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+	if decoded.Bounds().Dy() != 32 {
+		t.Errorf("Expected 32px height without a line gap, got %d", decoded.Bounds().Dy())
+	}
+}
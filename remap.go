@@ -0,0 +1,48 @@
+package img2ansi
+
+import (
+	"github.com/wbrown/img2ansi/imageutil"
+)
+
+// RemapBlocks converts a block grid rendered with another palette, such as
+// one read back with ParseANSI, to the Renderer's palette. Each cell's
+// four quadrant colors are rebuilt from its glyph and colors, and the
+// glyph and colors that best represent them in the Renderer's palette are
+// chosen as for a freshly dithered image.
+//
+// With diffuse set, the error of each cell is spread to its neighbors as
+// in BrownDitherForBlocks, which keeps gradients smoother when the target
+// palette is much smaller. Otherwise every cell is solved on its own and
+// the result stays as sharp as the original.
+func (r *Renderer) RemapBlocks(blocks [][]BlockRune, diffuse bool) [][]BlockRune {
+	grid := subpixelGrid(blocks)
+	if len(grid) == 0 || len(grid[0]) == 0 {
+		return nil
+	}
+
+	height, width := len(grid), len(grid[0])
+	if !diffuse {
+		result := make([][]BlockRune, height/2)
+		for by := range result {
+			result[by] = make([]BlockRune, width/2)
+			for bx := range result[by] {
+				block := [4]RGB{
+					grid[by*2][bx*2], grid[by*2][bx*2+1],
+					grid[by*2+1][bx*2], grid[by*2+1][bx*2+1],
+				}
+				ch, fg, bg := r.FindBestBlockRepresentation(block, false)
+				result[by][bx] = BlockRune{Rune: ch, FG: fg, BG: bg}
+			}
+		}
+		return result
+	}
+
+	img := imageutil.NewRGBAImage(width, height)
+	for y, row := range grid {
+		for x, c := range row {
+			img.SetRGB(x, y, c.toImageutil())
+		}
+	}
+	// The source cells are already hard edged, so no edges are marked
+	return r.BrownDitherForBlocks(img, imageutil.NewGrayImage(width, height))
+}
@@ -0,0 +1,57 @@
+package img2ansi
+
+import (
+	"testing"
+)
+
+func TestRemapBlocks(t *testing.T) {
+	t.Parallel()
+
+	r := NewRenderer(WithPalette("ansi16"))
+	red, black := RGB{0xAA, 0, 0}, RGB{0, 0, 0}
+	yellow, blue := RGB{0xFF, 0xFF, 0x55}, RGB{0, 0, 0xAA}
+
+	// Cells already in the palette keep their look
+	blocks := [][]BlockRune{
+		{{'▀', red, black}, {'▟', yellow, blue}, {' ', red, blue}},
+		{{'▘', blue, red}, {'█', yellow, black}, {'▐', black, yellow}},
+	}
+	remapped := r.RemapBlocks(blocks, false)
+	want, got := subpixelGrid(blocks), subpixelGrid(remapped)
+	for y := range want {
+		for x := range want[y] {
+			if got[y][x] != want[y][x] {
+				t.Errorf("Quadrant (%d,%d) = %v, want %v", x, y, got[y][x], want[y][x])
+			}
+		}
+	}
+
+	// Colors from a larger palette are mapped into this one
+	orange, teal := RGB{0xFF, 0x87, 0x00}, RGB{0x00, 0x87, 0x87}
+	wide := [][]BlockRune{
+		{{'▀', orange, teal}, {'▄', teal, orange}, {'▚', orange, teal}, {' ', teal, teal}},
+		{{'▌', teal, orange}, {'█', orange, teal}, {'▗', orange, teal}, {'▀', teal, orange}},
+	}
+	inPalette := make(map[RGB]bool)
+	for _, c := range append(append([]RGB{}, r.fgColors...), r.bgColors...) {
+		inPalette[c] = true
+	}
+	for _, diffuse := range []bool{false, true} {
+		remapped := r.RemapBlocks(wide, diffuse)
+		if len(remapped) != 2 || len(remapped[0]) != 4 {
+			t.Fatalf("diffuse=%v: expected a 4x2 grid, got %v", diffuse, remapped)
+		}
+		for y, row := range remapped {
+			for x, block := range row {
+				if !inPalette[block.FG] || !inPalette[block.BG] {
+					t.Errorf("diffuse=%v: cell (%d,%d) uses colors outside the palette: %v",
+						diffuse, x, y, block)
+				}
+			}
+		}
+	}
+
+	if r.RemapBlocks(nil, false) != nil {
+		t.Error("Expected nil for an empty grid")
+	}
+}
@@ -2,11 +2,11 @@ package img2ansi
 
 import (
 	"bytes"
-	"compress/gzip"
-	"encoding/gob"
 	"fmt"
+	"image"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 )
@@ -18,12 +18,26 @@ import (
 type Renderer struct {
 	// Configuration options
 	TargetWidth    int
+	TargetHeight   int
+	SizeMode       SizeMode
+	Crop           image.Rectangle
+	Zoom           float64
+	FocusX         float64
+	FocusY         float64
+	TableCacheDir  string
+	AdaptiveColors int
+	AdaptiveMethod QuantizeMethod
 	ScaleFactor    float64
 	MaxChars       int
 	Quantization   int
 	KdSearch       int
 	CacheThreshold float64
 	ColorMethod    ColorDistanceMethod
+	LineReset      bool
+	ComplementSwap bool
+	RateLambda     float64
+	DebugSink      DebugSink
+	Progress       ProgressFunc
 
 	// Palette state (private)
 	palettePath   string
@@ -60,7 +74,9 @@ type RendererOption func(*Renderer)
 
 // NewRenderer creates a new Renderer with the given options.
 // Default values: KdSearch=0 (use precomputed tables), ColorMethod=RedmeanMethod{},
-// ScaleFactor=2.0, CacheThreshold=200.0, MaxChars=1048576, TargetWidth=100, Quantization=256.
+// ScaleFactor=2.0, CacheThreshold=200.0, MaxChars=1048576, TargetWidth=100, Quantization=256,
+// LineReset=true, ComplementSwap=true, RateLambda=0, SizeMode=SizeWidth,
+// Zoom=1, FocusX=0.5, FocusY=0.5.
 func NewRenderer(opts ...RendererOption) *Renderer {
 	r := &Renderer{
 		// Default configuration
@@ -71,6 +87,11 @@ func NewRenderer(opts ...RendererOption) *Renderer {
 		KdSearch:       0, // Use precomputed tables by default
 		CacheThreshold: 200.0,
 		ColorMethod:    RedmeanMethod{},
+		LineReset:      true,
+		ComplementSwap: true,
+		Zoom:           1,
+		FocusX:         0.5,
+		FocusY:         0.5,
 
 		// Initialize maps and cache
 		fgAnsiRev:     make(map[string]uint32),
@@ -96,6 +117,15 @@ func WithPalette(path string) RendererOption {
 	}
 }
 
+// WithPaletteData sets palettes built in memory, such as a Scheme's, and
+// loads them immediately with LoadPaletteData. Options it depends on,
+// like WithColorMethod and WithTableCache, must come before it.
+func WithPaletteData(name string, fgData, bgData AnsiData) RendererOption {
+	return func(r *Renderer) {
+		r.LoadPaletteData(name, fgData, bgData)
+	}
+}
+
 // WithColorMethod sets the color distance calculation method.
 func WithColorMethod(method ColorDistanceMethod) RendererOption {
 	return func(r *Renderer) {
@@ -117,6 +147,17 @@ func WithScaleFactor(factor float64) RendererOption {
 	}
 }
 
+// WithCellSize sets ScaleFactor from the size of a terminal cell in
+// pixels, for fonts whose cells aren't twice as tall as they are wide.
+// Sizes that aren't positive are ignored.
+func WithCellSize(width, height int) RendererOption {
+	return func(r *Renderer) {
+		if width > 0 && height > 0 {
+			r.ScaleFactor = float64(height) / float64(width)
+		}
+	}
+}
+
 // WithCacheThreshold sets the error threshold for cache lookups.
 func WithCacheThreshold(threshold float64) RendererOption {
 	return func(r *Renderer) {
@@ -124,13 +165,60 @@ func WithCacheThreshold(threshold float64) RendererOption {
 	}
 }
 
-// WithMaxChars sets the maximum number of characters in output.
+// WithMaxChars sets the maximum number of bytes of compressed output that
+// ImageToANSI fits the image into.
 func WithMaxChars(max int) RendererOption {
 	return func(r *Renderer) {
 		r.MaxChars = max
 	}
 }
 
+// WithLineReset sets whether compressed output resets colors at the end
+// of every line. Resetting keeps a line's colors from leaking into what
+// the terminal shows around it; turning it off saves a few bytes a line.
+func WithLineReset(enabled bool) RendererOption {
+	return func(r *Renderer) {
+		r.LineReset = enabled
+	}
+}
+
+// WithComplementSwap sets whether compressed output may draw quadrant
+// glyphs as their complement with swapped colors when that needs fewer
+// escape sequences. The output looks the same either way.
+func WithComplementSwap(enabled bool) RendererOption {
+	return func(r *Renderer) {
+		r.ComplementSwap = enabled
+	}
+}
+
+// WithRateLambda sets how much block error BrownDitherForBlocks accepts
+// to save a byte of compressed output. Blocks are chosen to minimize their
+// error plus lambda times the bytes of escape codes and glyph needed to
+// draw them after the previous block. Zero, the default, picks the most
+// accurate blocks regardless of size.
+func WithRateLambda(lambda float64) RendererOption {
+	return func(r *Renderer) {
+		r.RateLambda = lambda
+	}
+}
+
+// WithDebugSink sets where the intermediate images of ImageToANSI go. By
+// default they are discarded.
+func WithDebugSink(sink DebugSink) RendererOption {
+	return func(r *Renderer) {
+		r.DebugSink = sink
+	}
+}
+
+// WithProgress sets a callback that is called after each row of blocks a
+// render dithers, e.g. to show a progress bar. It is called on the
+// rendering goroutine, so it should return quickly.
+func WithProgress(fn ProgressFunc) RendererOption {
+	return func(r *Renderer) {
+		r.Progress = fn
+	}
+}
+
 // WithTargetWidth sets the target width in characters.
 func WithTargetWidth(width int) RendererOption {
 	return func(r *Renderer) {
@@ -138,17 +226,104 @@ func WithTargetWidth(width int) RendererOption {
 	}
 }
 
-// LoadPalette loads a color palette from the given path.
+// WithTargetHeight sets the target height in lines, used by the
+// SizeHeight, SizeFit and SizeFill modes.
+func WithTargetHeight(height int) RendererOption {
+	return func(r *Renderer) {
+		r.TargetHeight = height
+	}
+}
+
+// WithCrop sets the rectangle of the source image, in pixels, that is
+// rendered. It is cropped at full resolution before resizing, so a small
+// part of a large image keeps its detail. An empty rectangle, the
+// default, renders the whole image.
+func WithCrop(rect image.Rectangle) RendererOption {
+	return func(r *Renderer) {
+		r.Crop = rect
+	}
+}
+
+// WithZoom sets how far to zoom in on the focus point: a zoom of 2 renders
+// the half of the (cropped) image's width and height around it. Zooms of
+// 1 or less render all of it.
+func WithZoom(zoom float64) RendererOption {
+	return func(r *Renderer) {
+		r.Zoom = zoom
+	}
+}
+
+// WithFocus sets the point Zoom centers on, as fractions of the (cropped)
+// image's width and height from its top left corner. The default is the
+// center, 0.5, 0.5.
+func WithFocus(x, y float64) RendererOption {
+	return func(r *Renderer) {
+		r.FocusX, r.FocusY = x, y
+	}
+}
+
+// WithTableCache sets a directory where LoadPaletteData keeps the color
+// tables it computes, so that loading the same colors again is fast.
+func WithTableCache(dir string) RendererOption {
+	return func(r *Renderer) {
+		r.TableCacheDir = dir
+	}
+}
+
+// WithAdaptivePalette renders each image with a palette of n colors
+// derived from it by the given method, emitted as 24-bit color codes for
+// truecolor terminals. The palette replaces the loaded one when
+// RenderImage, RenderToBudget, BrownDitherForBlocks or RenderStream
+// render an image; FrameRenderer frames keep the palette they start with,
+// so that it doesn't change between frames. The Renderer keeps the
+// adaptive palette after rendering, so that rendering the same colors again
+// reuses its tables; LoadPalette goes back to a fixed one. Zero, the
+// default, renders with the loaded palette.
+func WithAdaptivePalette(n int, method QuantizeMethod) RendererOption {
+	return func(r *Renderer) {
+		r.AdaptiveColors = n
+		r.AdaptiveMethod = method
+	}
+}
+
+// WithSizeMode sets how TargetWidth and TargetHeight size the output.
+func WithSizeMode(mode SizeMode) RendererOption {
+	return func(r *Renderer) {
+		r.SizeMode = mode
+	}
+}
+
+// LoadPalette loads a color palette from the given path, or the embedded
+// palette with that name, such as "ansi256" or "solarized-dark".
 // If the same palette with the same color method is already loaded,
 // this is a no-op (smart caching). The lookupTable cache is preserved
 // unless the palette actually changes.
 func (r *Renderer) LoadPalette(path string) error {
+	if name, ok := paletteAliases[path]; ok {
+		path = name
+	}
+
 	// Smart caching: skip reload if already loaded with same settings
 	if r.paletteLoaded && r.palettePath == path {
 		// Palette already loaded, nothing to do
 		return nil
 	}
 
+	// Terminal color schemes are imported as 16 color palettes
+	if data, err := os.ReadFile(path); err == nil {
+		if format := DetectSchemeFormat(path, data); format != "" {
+			scheme, err := ParseScheme(bytes.NewReader(data), format)
+			if err != nil {
+				return fmt.Errorf("%s: %v", path, err)
+			}
+			fgData, bgData, err := scheme.AnsiData(16)
+			if err != nil {
+				return err
+			}
+			return r.LoadPaletteData(path, fgData, bgData)
+		}
+	}
+
 	// Determine format and delegate
 	var fgTables, bgTables *ComputedTables
 	var err error
@@ -163,7 +338,65 @@ func (r *Renderer) LoadPalette(path string) error {
 	if err != nil {
 		return err
 	}
+	r.usePalette(path, fgTables, bgTables)
+	return nil
+}
+
+// LoadPaletteData computes the color tables for foreground and background
+// palettes, such as those Scheme.AnsiData returns, and uses them. The name
+// identifies the palette like a path does for LoadPalette: loading the
+// same name again is a no-op. Computing the tables for a built-in
+// ColorMethod takes a while, like loading a JSON palette, so with
+// TableCacheDir set they are kept there for the next time the same colors
+// are loaded.
+func (r *Renderer) LoadPaletteData(name string, fgData, bgData AnsiData) error {
+	if r.paletteLoaded && r.palettePath == name {
+		return nil
+	}
+	if len(fgData) == 0 || len(bgData) == 0 {
+		return fmt.Errorf("palette %s has no colors", name)
+	}
+	if r.TableCacheDir != "" {
+		fgTables, bgTables := r.cachedPaletteTables(fgData, bgData)
+		r.usePalette(name, &fgTables, &bgTables)
+		return nil
+	}
+	fgTables, bgTables := r.computePaletteTables(fgData, bgData, false)
+	r.usingPrecomputed = false
+	r.usePalette(name, fgTables, bgTables)
+	return nil
+}
+
+// cachedPaletteTables returns the tables for the palettes from
+// TableCacheDir, in a .palette file named by a hash of their colors,
+// computing and adding them if the file doesn't have them for the
+// ColorMethod. The cache is only an optimization, so a cache that can't be
+// read or written is recomputed or left alone.
+func (r *Renderer) cachedPaletteTables(fgData, bgData AnsiData) (ComputedTables, ComputedTables) {
+	path := filepath.Join(r.TableCacheDir, paletteHash(fgData, bgData)+".palette")
+	cmct := make(ColorMethodCompactTables)
+	if data, err := os.ReadFile(path); err == nil {
+		if cached, err := decodePaletteTables(data); err == nil {
+			cmct = cached
+		}
+	}
+
+	pair, ok := cmct[r.ColorMethod.Name()]
+	if !ok {
+		pair = compactTablePair(fgData, bgData, r.ColorMethod)
+		cmct[r.ColorMethod.Name()] = pair
+		if data, err := encodePaletteTables(cmct); err == nil &&
+			os.MkdirAll(r.TableCacheDir, 0755) == nil {
+			os.WriteFile(path, data, 0644)
+		}
+	}
+	r.usingPrecomputed = true
+	return pair.Fg.Restore(), pair.Bg.Restore()
+}
 
+// usePalette makes the Renderer use the given tables for the palette
+// with the given path or name.
+func (r *Renderer) usePalette(path string, fgTables, bgTables *ComputedTables) {
 	// Populate Renderer fields
 	r.fgAnsi = fgTables.AnsiData.ToOrderedMap()
 	r.bgAnsi = bgTables.AnsiData.ToOrderedMap()
@@ -202,8 +435,6 @@ func (r *Renderer) LoadPalette(path string) error {
 	// Mark as loaded
 	r.palettePath = path
 	r.paletteLoaded = true
-
-	return nil
 }
 
 // buildReverseMap builds reverse lookups for ANSI codes from raw AnsiData.
@@ -246,16 +477,9 @@ func (r *Renderer) loadPaletteBinary(path string) (*ComputedTables, *ComputedTab
 		}
 	}
 
-	gzr, err := gzip.NewReader(bytes.NewReader(data))
+	cmct, err := decodePaletteTables(data)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create gzip reader: %v", err)
-	}
-	defer gzr.Close()
-
-	var cmct ColorMethodCompactTables
-	dec := gob.NewDecoder(gzr)
-	if err := dec.Decode(&cmct); err != nil {
-		return nil, nil, fmt.Errorf("failed to decode palette data: %v", err)
+		return nil, nil, err
 	}
 
 	cct, ok := cmct[r.ColorMethod.Name()]
@@ -289,7 +513,17 @@ func (r *Renderer) loadPaletteJSON(path string, fastMode bool) (*ComputedTables,
 	if err != nil {
 		return nil, nil, err
 	}
+	fgTables, bgTables := r.computePaletteTables(fgData, bgData, fastMode)
+	return fgTables, bgTables, nil
+}
 
+// computePaletteTables computes the tables for foreground and background
+// palettes, skipping the background's if it has the same colors. fastMode
+// is as for loadPaletteJSON.
+func (r *Renderer) computePaletteTables(
+	fgData, bgData AnsiData,
+	fastMode bool,
+) (*ComputedTables, *ComputedTables) {
 	var fgComputedTable ComputedTables
 	if fastMode {
 		fgComputedTable = ComputeTablesForKdSearch(fgData)
@@ -310,7 +544,7 @@ func (r *Renderer) loadPaletteJSON(path string, fastMode bool) (*ComputedTables,
 		bgComputedTable = ComputedTables{AnsiData: bgData}
 	}
 
-	return &fgComputedTable, &bgComputedTable, nil
+	return &fgComputedTable, &bgComputedTable
 }
 
 // CacheStats returns cache hit/miss statistics.
@@ -358,6 +592,15 @@ func (r *Renderer) GetBestBlockTime() time.Duration {
 
 // UsingPrecomputedTables returns true if the renderer is using precomputed
 // lookup tables for color matching, false if it fell back to KD-tree search.
+// Tables are precomputed when they come from a .palette file: an embedded
+// palette, one loaded by path, or one kept in TableCacheDir.
 func (r *Renderer) UsingPrecomputedTables() bool {
 	return r.usingPrecomputed
 }
+
+// HasLookupTables returns true if the renderer matches colors by table
+// lookup, whether the tables were precomputed or computed when the palette
+// was loaded, false if it fell back to KD-tree search.
+func (r *Renderer) HasLookupTables() bool {
+	return r.fgClosestColor != nil
+}
@@ -0,0 +1,781 @@
+package img2ansi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Scheme is a terminal color scheme: the 16 basic colors and the default
+// foreground and background, as imported from a terminal's settings.
+type Scheme struct {
+	Name       string
+	Foreground RGB
+	Background RGB
+	// Colors are the 8 normal colors, black to white, then their 8
+	// bright variants.
+	Colors [16]RGB
+	// Extended sets colors 16 to 255 of a 256 color palette, for schemes
+	// that change them from xterm's defaults.
+	Extended map[int]RGB
+}
+
+// SchemeFormat names a color scheme file format.
+type SchemeFormat string
+
+const (
+	// SchemeITerm2 is an iTerm2 .itermcolors property list.
+	SchemeITerm2 SchemeFormat = "iterm2"
+	// SchemeWindowsTerminal is a Windows Terminal scheme object, or a
+	// settings.json whose first scheme is used.
+	SchemeWindowsTerminal SchemeFormat = "windows-terminal"
+	// SchemeXresources is an X resources file setting color0 to color15.
+	SchemeXresources SchemeFormat = "xresources"
+	// SchemeKitty is a kitty.conf or kitty theme file.
+	SchemeKitty SchemeFormat = "kitty"
+	// SchemeAlacrittyTOML is an Alacritty TOML configuration or theme.
+	SchemeAlacrittyTOML SchemeFormat = "alacritty-toml"
+	// SchemeAlacrittyYAML is an older Alacritty YAML configuration.
+	SchemeAlacrittyYAML SchemeFormat = "alacritty-yaml"
+	// SchemeBase16 is a base16 scheme YAML file, mapped to terminal
+	// colors the way base16-shell does.
+	SchemeBase16 SchemeFormat = "base16"
+)
+
+// colorNames are the names most formats give the 8 normal colors.
+var colorNames = [8]string{
+	"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white",
+}
+
+// base16Colors are the base16 slots base16-shell uses for the 16 terminal
+// colors.
+var base16Colors = [16]string{
+	"base00", "base08", "base0B", "base0A", "base0D", "base0E", "base0C", "base05",
+	"base03", "base08", "base0B", "base0A", "base0D", "base0E", "base0C", "base07",
+}
+
+// LoadScheme reads a color scheme file, detecting its format with
+// DetectSchemeFormat.
+func LoadScheme(path string) (*Scheme, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading scheme: %v", err)
+	}
+	format := DetectSchemeFormat(path, data)
+	if format == "" {
+		return nil, fmt.Errorf("unrecognized color scheme format: %s", path)
+	}
+	scheme, err := ParseScheme(bytes.NewReader(data), format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if scheme.Name == "" {
+		base := filepath.Base(path)
+		scheme.Name = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	return scheme, nil
+}
+
+// DetectSchemeFormat guesses the format of a color scheme file from its
+// name and contents. It returns "" for files that aren't color schemes,
+// including .palette files and the code-to-hex JSON palettes
+// ReadAnsiDataFromJSON reads. Names starting with "kitty" or "xresources"
+// are only taken as schemes if they have no extension.
+func DetectSchemeFormat(path string, data []byte) SchemeFormat {
+	base := strings.ToLower(filepath.Base(path))
+	switch ext := filepath.Ext(base); {
+	case ext == ".palette":
+		return ""
+	case ext == ".itermcolors":
+		return SchemeITerm2
+	case ext == ".json":
+		var probe map[string]json.RawMessage
+		if json.Unmarshal(stripJSONComments(data), &probe) != nil {
+			return ""
+		}
+		if _, ok := probe["schemes"]; ok {
+			return SchemeWindowsTerminal
+		}
+		if _, ok := probe["brightBlack"]; ok {
+			return SchemeWindowsTerminal
+		}
+		return ""
+	case ext == ".toml":
+		return SchemeAlacrittyTOML
+	case ext == ".yml" || ext == ".yaml":
+		if bytes.Contains(data, []byte("base0D")) ||
+			bytes.Contains(data, []byte("base0d")) {
+			return SchemeBase16
+		}
+		return SchemeAlacrittyYAML
+	case ext == ".conf" || ext == "" && strings.HasPrefix(base, "kitty"):
+		return SchemeKitty
+	case ext == ".xresources" || ext == ".xdefaults" ||
+		base == ".xresources" || base == ".xdefaults" ||
+		ext == "" && strings.HasPrefix(base, "xresources"):
+		return SchemeXresources
+	}
+	return ""
+}
+
+// ParseScheme reads a color scheme in the given format. Every format must
+// set all 16 colors; a missing foreground or background defaults to
+// color 7 or color 0.
+func ParseScheme(r io.Reader, format SchemeFormat) (*Scheme, error) {
+	var b schemeBuilder
+	var err error
+	switch format {
+	case SchemeITerm2:
+		err = b.parseITerm2(r)
+	case SchemeWindowsTerminal:
+		err = b.parseWindowsTerminal(r)
+	case SchemeXresources:
+		err = b.parseXresources(r)
+	case SchemeKitty:
+		err = b.parseKitty(r)
+	case SchemeAlacrittyTOML:
+		err = b.parseAlacritty(r, readTOMLValues)
+	case SchemeAlacrittyYAML:
+		err = b.parseAlacritty(r, readYAMLValues)
+	case SchemeBase16:
+		err = b.parseBase16(r)
+	default:
+		return nil, fmt.Errorf("unknown color scheme format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return b.scheme()
+}
+
+// AnsiData returns the foreground and background palettes for the
+// scheme, ready for table computation. With 16 colors they use the basic
+// codes 30-37 and 90-97 (40-47 and 100-107); with 256 they use the
+// 38;5;N codes, the scheme's colors followed by xterm's 6x6x6 color cube
+// and gray ramp, or the Extended colors that replace them.
+func (s *Scheme) AnsiData(colors int) (AnsiData, AnsiData, error) {
+	var fg, bg AnsiData
+	switch colors {
+	case 16:
+		for i, c := range s.Colors {
+			code := 30 + i
+			if i >= 8 {
+				code = 90 + i - 8
+			}
+			fg = append(fg, AnsiEntry{Key: c.toUint32(), Value: strconv.Itoa(code)})
+			bg = append(bg, AnsiEntry{Key: c.toUint32(), Value: strconv.Itoa(code + 10)})
+		}
+	case 256:
+		for i := 0; i < 256; i++ {
+			c, ok := s.Extended[i]
+			if !ok {
+				c = xtermColor(i)
+			}
+			if i < 16 {
+				c = s.Colors[i]
+			}
+			fg = append(fg, AnsiEntry{Key: c.toUint32(), Value: fmt.Sprintf("38;5;%d", i)})
+			bg = append(bg, AnsiEntry{Key: c.toUint32(), Value: fmt.Sprintf("48;5;%d", i)})
+		}
+	default:
+		return nil, nil, fmt.Errorf("schemes make 16 or 256 color palettes, not %d", colors)
+	}
+	sort.Sort(ByAnsiCode(fg))
+	sort.Sort(ByAnsiCode(bg))
+	return fg, bg, nil
+}
+
+var (
+	// paletteReply is a reply to an OSC 4 query for a palette color:
+	// OSC 4 ; index ; color, ended by BEL or ST.
+	paletteReply = regexp.MustCompile(`\x1b\]4;(\d+);([^\x07\x1b]*)(?:\x07|\x1b\\)`)
+	// defaultColorReply is a reply to an OSC 10 or 11 query for the
+	// default foreground or background color.
+	defaultColorReply = regexp.MustCompile(`\x1b\](1[01]);([^\x07\x1b]*)(?:\x07|\x1b\\)`)
+)
+
+// ParseColorReplies builds a scheme from a terminal's replies to OSC 4
+// queries for its palette colors and OSC 10 and 11 queries for its
+// default foreground and background. Colors 0 to 15 must all be there;
+// replies for colors 16 to 255 become the scheme's Extended colors.
+// Other output mixed in with the replies is ignored.
+func ParseColorReplies(reply []byte) (*Scheme, error) {
+	matches := paletteReply.FindAllSubmatch(reply, -1)
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no palette colors in the reply")
+	}
+	var b schemeBuilder
+	for _, m := range matches {
+		n, err := strconv.Atoi(string(m[1]))
+		if err != nil || n > 255 {
+			continue
+		}
+		c, err := parseSchemeColor(string(m[2]))
+		if err != nil {
+			return nil, fmt.Errorf("color %d: %v", n, err)
+		}
+		if n < 16 {
+			b.setColor(n, c)
+			continue
+		}
+		if b.s.Extended == nil {
+			b.s.Extended = make(map[int]RGB)
+		}
+		b.s.Extended[n] = c
+	}
+	for _, m := range defaultColorReply.FindAllSubmatch(reply, -1) {
+		key := "foreground"
+		if string(m[1]) == "11" {
+			key = "background"
+		}
+		if err := b.set(key, string(m[2])); err != nil {
+			return nil, err
+		}
+	}
+	return b.scheme()
+}
+
+// schemeBuilder collects the colors of a scheme as a parser finds them.
+type schemeBuilder struct {
+	s              Scheme
+	have           [16]bool
+	haveFg, haveBg bool
+}
+
+// setColor sets color n, 0 to 15.
+func (b *schemeBuilder) setColor(n int, c RGB) {
+	if n >= 0 && n < 16 {
+		b.s.Colors[n] = c
+		b.have[n] = true
+	}
+}
+
+// set sets the color a key names: a color number, a color name with an
+// optional "bright" prefix, or foreground or background. Other keys are
+// ignored. Values that aren't colors are an error.
+func (b *schemeBuilder) set(key, value string) error {
+	key = strings.ToLower(key)
+	n := -1
+	switch {
+	case key == "foreground":
+	case key == "background":
+	case strings.HasPrefix(key, "color"):
+		v, err := strconv.Atoi(strings.TrimPrefix(key, "color"))
+		if err != nil || v < 0 || v > 15 {
+			return nil
+		}
+		n = v
+	default:
+		n = colorIndex(key)
+		if n < 0 {
+			return nil
+		}
+	}
+	c, err := parseSchemeColor(value)
+	if err != nil {
+		return fmt.Errorf("%s: %v", key, err)
+	}
+	switch key {
+	case "foreground":
+		b.s.Foreground, b.haveFg = c, true
+	case "background":
+		b.s.Background, b.haveBg = c, true
+	default:
+		b.setColor(n, c)
+	}
+	return nil
+}
+
+// scheme returns the finished scheme, or an error naming the first color
+// that wasn't set.
+func (b *schemeBuilder) scheme() (*Scheme, error) {
+	for n, ok := range b.have {
+		if !ok {
+			return nil, fmt.Errorf("scheme doesn't set color %d", n)
+		}
+	}
+	if !b.haveFg {
+		b.s.Foreground = b.s.Colors[7]
+	}
+	if !b.haveBg {
+		b.s.Background = b.s.Colors[0]
+	}
+	s := b.s
+	return &s, nil
+}
+
+// colorIndex returns the color number for a name like "red" or
+// "brightRed" (case-insensitive, "purple" for magenta), or -1.
+func colorIndex(name string) int {
+	name = strings.ToLower(name)
+	offset := 0
+	if rest, ok := strings.CutPrefix(name, "bright"); ok {
+		name, offset = strings.TrimLeft(rest, "_-"), 8
+	}
+	if name == "purple" {
+		name = "magenta"
+	}
+	for i, n := range colorNames {
+		if n == name {
+			return i + offset
+		}
+	}
+	return -1
+}
+
+// parseSchemeColor parses the color notations schemes use: "#rrggbb",
+// "#rgb", "0xrrggbb", bare "rrggbb" and X11's "rgb:r/g/b" with 1 to 4 hex
+// digits per component. Surrounding quotes are ignored.
+func parseSchemeColor(value string) (RGB, error) {
+	v := strings.Trim(strings.TrimSpace(value), `"'`)
+	if rest, ok := strings.CutPrefix(strings.ToLower(v), "rgb:"); ok {
+		parts := strings.Split(rest, "/")
+		if len(parts) != 3 {
+			return RGB{}, fmt.Errorf("invalid color %q", value)
+		}
+		var c [3]uint8
+		for i, part := range parts {
+			n, err := strconv.ParseUint(part, 16, 16)
+			if err != nil || len(part) == 0 || len(part) > 4 {
+				return RGB{}, fmt.Errorf("invalid color %q", value)
+			}
+			// Scale to 8 bits, e.g. "f" is 0xff and "ffff" is 0xff
+			maxVal := float64(uint64(1)<<(4*len(part)) - 1)
+			c[i] = uint8(math.Round(float64(n) / maxVal * 255))
+		}
+		return RGB{c[0], c[1], c[2]}, nil
+	}
+
+	switch {
+	case strings.HasPrefix(v, "#"):
+		v = v[1:]
+	case strings.HasPrefix(v, "0x") || strings.HasPrefix(v, "0X"):
+		v = v[2:]
+	}
+	if len(v) == 3 {
+		v = string([]byte{v[0], v[0], v[1], v[1], v[2], v[2]})
+	}
+	n, err := strconv.ParseUint(v, 16, 32)
+	if err != nil || len(v) != 6 {
+		return RGB{}, fmt.Errorf("invalid color %q", value)
+	}
+	return rgbFromUint32(uint32(n)), nil
+}
+
+// parseITerm2 reads an .itermcolors property list, a dict of "Ansi N
+// Color", "Foreground Color" and "Background Color" entries, each a dict
+// of red, green and blue components from 0 to 1.
+func (b *schemeBuilder) parseITerm2(r io.Reader) error {
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return fmt.Errorf("no dict in property list")
+		}
+		if err != nil {
+			return fmt.Errorf("error parsing property list: %v", err)
+		}
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local == "dict" {
+			break
+		}
+	}
+	root, err := readPlistDict(dec)
+	if err != nil {
+		return fmt.Errorf("error parsing property list: %v", err)
+	}
+
+	for key, value := range root {
+		comps, ok := value.(map[string]any)
+		if !ok {
+			continue
+		}
+		var c [3]uint8
+		for i, name := range []string{"Red", "Green", "Blue"} {
+			v, _ := comps[name+" Component"].(float64)
+			c[i] = uint8(math.Round(math.Max(0, math.Min(1, v)) * 255))
+		}
+		rgb := RGB{c[0], c[1], c[2]}
+
+		switch key {
+		case "Foreground Color":
+			b.s.Foreground, b.haveFg = rgb, true
+		case "Background Color":
+			b.s.Background, b.haveBg = rgb, true
+		default:
+			var n int
+			if _, err := fmt.Sscanf(key, "Ansi %d Color", &n); err == nil {
+				b.setColor(n, rgb)
+			}
+		}
+	}
+	return nil
+}
+
+// readPlistDict reads the entries of a property list dict whose start
+// element has been read, up to its end element. Nested dicts become maps,
+// reals and integers float64s and everything else strings.
+func readPlistDict(dec *xml.Decoder) (map[string]any, error) {
+	dict := make(map[string]any)
+	var key string
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.EndElement:
+			return dict, nil
+		case xml.StartElement:
+			var value any
+			switch t.Name.Local {
+			case "dict":
+				if value, err = readPlistDict(dec); err != nil {
+					return nil, err
+				}
+			default:
+				var text string
+				if err := dec.DecodeElement(&text, &t); err != nil {
+					return nil, err
+				}
+				switch t.Name.Local {
+				case "key":
+					key = text
+					continue
+				case "real", "integer":
+					value, _ = strconv.ParseFloat(strings.TrimSpace(text), 64)
+				default:
+					value = text
+				}
+			}
+			dict[key] = value
+		}
+	}
+}
+
+// parseWindowsTerminal reads a Windows Terminal scheme object, or the
+// first scheme in a settings file's "schemes" list. Comments and trailing
+// commas, which Windows Terminal writes in its settings, are allowed.
+func (b *schemeBuilder) parseWindowsTerminal(r io.Reader) error {
+	var doc struct {
+		Schemes []map[string]any `json:"schemes"`
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	data = stripJSONComments(data)
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("error parsing JSON: %v", err)
+	}
+	scheme := map[string]any{}
+	if len(doc.Schemes) > 0 {
+		scheme = doc.Schemes[0]
+	} else if err := json.Unmarshal(data, &scheme); err != nil {
+		return fmt.Errorf("error parsing JSON: %v", err)
+	}
+
+	for key, value := range scheme {
+		s, ok := value.(string)
+		if !ok {
+			continue
+		}
+		if key == "name" {
+			b.s.Name = s
+			continue
+		}
+		if err := b.set(key, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stripJSONComments removes // and /* */ comments and trailing commas
+// before a closing bracket or brace from JSON with comments, leaving
+// strings as they are, so that it can be read as plain JSON.
+func stripJSONComments(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	comma := -1 // index in out of a comma that may be trailing
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c == '"':
+			start := i
+			for i++; i < len(data) && data[i] != '"'; i++ {
+				if data[i] == '\\' {
+					i++
+				}
+			}
+			out = append(out, data[start:min(i+1, len(data))]...)
+			comma = -1
+		case c == '/' && i+1 < len(data) && data[i+1] == '/':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+			i--
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			end := bytes.Index(data[i+2:], []byte("*/"))
+			if end < 0 {
+				return out
+			}
+			i += end + 3
+		case c == ',':
+			comma = len(out)
+			out = append(out, c)
+		case c == '}' || c == ']':
+			if comma >= 0 {
+				out = append(out[:comma], out[comma+1:]...)
+			}
+			out = append(out, c)
+			comma = -1
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			out = append(out, c)
+		default:
+			out = append(out, c)
+			comma = -1
+		}
+	}
+	return out
+}
+
+// parseXresources reads "*.color0: #000000" style resources. The
+// resource's class or instance prefix is ignored, comments start with "!"
+// and "#define NAME value" macros are expanded.
+func (b *schemeBuilder) parseXresources(r io.Reader) error {
+	defines := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "!") {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "#define"); ok {
+			if fields := strings.Fields(rest); len(fields) == 2 {
+				defines[fields[0]] = fields[1]
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		if i := strings.LastIndexAny(key, ".*"); i >= 0 {
+			key = key[i+1:]
+		}
+		value = strings.TrimSpace(value)
+		if def, ok := defines[value]; ok {
+			value = def
+		}
+		if err := b.set(key, value); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// parseKitty reads "color0 #000000" lines from a kitty configuration.
+func (b *schemeBuilder) parseKitty(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		// Only colors are set with these keys; "selection_foreground"
+		// and the like are ignored
+		key := fields[0]
+		if key != "foreground" && key != "background" &&
+			!strings.HasPrefix(key, "color") {
+			continue
+		}
+		if err := b.set(key, fields[1]); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// parseAlacritty reads the colors.primary, colors.normal and
+// colors.bright tables of an Alacritty configuration, read into dotted
+// key paths by readValues.
+func (b *schemeBuilder) parseAlacritty(
+	r io.Reader,
+	readValues func(io.Reader) (map[string]string, error),
+) error {
+	values, err := readValues(r)
+	if err != nil {
+		return err
+	}
+	for path, value := range values {
+		section, key, found := cutLast(path, ".")
+		if !found {
+			continue
+		}
+		switch section {
+		case "colors.primary":
+			if key != "foreground" && key != "background" {
+				continue
+			}
+		case "colors.normal":
+		case "colors.bright":
+			if colorIndex(key) < 0 {
+				continue
+			}
+			key = "bright" + key
+		default:
+			continue
+		}
+		if err := b.set(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseBase16 reads the base00 to base0F colors of a base16 scheme, at the
+// top level or under "palette", and maps them to terminal colors.
+func (b *schemeBuilder) parseBase16(r io.Reader) error {
+	values, err := readYAMLValues(r)
+	if err != nil {
+		return err
+	}
+	slots := make(map[string]string)
+	for path, value := range values {
+		_, key, _ := cutLast(path, ".")
+		switch {
+		case strings.HasPrefix(strings.ToLower(key), "base"):
+			slots[strings.ToLower(key)] = value
+		case path == "scheme" || path == "name":
+			b.s.Name = strings.Trim(value, `"'`)
+		}
+	}
+
+	for n, slot := range base16Colors {
+		value, ok := slots[strings.ToLower(slot)]
+		if !ok {
+			return fmt.Errorf("scheme doesn't set %s", slot)
+		}
+		c, err := parseSchemeColor(value)
+		if err != nil {
+			return fmt.Errorf("%s: %v", slot, err)
+		}
+		b.setColor(n, c)
+	}
+	b.s.Foreground, b.haveFg = b.s.Colors[7], true
+	b.s.Background, b.haveBg = b.s.Colors[0], true
+	return nil
+}
+
+// cutLast slices s around the last instance of sep.
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return "", s, false
+}
+
+// stripComment removes a trailing "#" comment from a TOML or YAML line,
+// leaving any "#" inside quotes, as colors often have.
+func stripComment(line string) string {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// readTOMLValues reads the "key = value" pairs of a TOML document into a
+// map from dotted key paths, e.g. "colors.normal.black", to their raw
+// values. It covers the tables and strings scheme files use, not all of
+// TOML.
+func readTOMLValues(r io.Reader) (map[string]string, error) {
+	values := make(map[string]string)
+	table := ""
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "["):
+			table = strings.Trim(line, "[] ")
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		path := strings.Trim(strings.TrimSpace(key), `"'`)
+		if table != "" {
+			path = table + "." + path
+		}
+		values[path] = strings.TrimSpace(value)
+	}
+	return values, scanner.Err()
+}
+
+// readYAMLValues reads the "key: value" pairs of a YAML document into a
+// map from dotted key paths, following nesting by indentation. It covers
+// the block mappings scheme files use, not all of YAML.
+func readYAMLValues(r io.Reader) (map[string]string, error) {
+	type level struct {
+		indent int
+		key    string
+	}
+	values := make(map[string]string)
+	var stack []level
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		text := stripComment(scanner.Text())
+		line := strings.TrimSpace(text)
+		if line == "" || line == "---" || strings.HasPrefix(line, "- ") {
+			continue
+		}
+		indent := len(text) - len(strings.TrimLeft(text, " \t"))
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.Trim(strings.TrimSpace(key), `"'`)
+		value = strings.TrimSpace(value)
+
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		path := key
+		if len(stack) > 0 {
+			path = stack[len(stack)-1].key + "." + key
+		}
+		// Anchors like "&colors" start a nested mapping too
+		if value == "" || strings.HasPrefix(value, "&") {
+			stack = append(stack, level{indent, path})
+			continue
+		}
+		values[path] = value
+	}
+	return values, scanner.Err()
+}
@@ -0,0 +1,464 @@
+package img2ansi
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testSchemeColor is the color the scheme fixtures below set for n: color n is
+// {n*16, 255-n*16, n}. Their foreground is testFg and background testBg.
+func testSchemeColor(n int) RGB {
+	return RGB{uint8(n * 16), uint8(255 - n*16), uint8(n)}
+}
+
+var (
+	testFg = RGB{1, 2, 3}
+	testBg = RGB{4, 5, 6}
+)
+
+// schemeLines formats a line per color with the given function, which
+// gets the color's number, name ("red", "brightRed") and hex value.
+func schemeLines(line func(n int, name, hex string) string) string {
+	var sb strings.Builder
+	for n := 0; n < 16; n++ {
+		name := colorNames[n%8]
+		if n >= 8 {
+			name = "bright" + strings.ToUpper(name[:1]) + name[1:]
+		}
+		sb.WriteString(line(n, name, testSchemeColor(n).hex()) + "\n")
+	}
+	return sb.String()
+}
+
+func iTermFixture() string {
+	component := func(name string, v uint8) string {
+		return fmt.Sprintf("<key>%s Component</key><real>%v</real>",
+			name, float64(v)/255)
+	}
+	entry := func(key string, c RGB) string {
+		return fmt.Sprintf("<key>%s</key><dict>%s%s%s"+
+			"<key>Color Space</key><string>sRGB</string></dict>\n", key,
+			component("Red", c.R), component("Green", c.G), component("Blue", c.B))
+	}
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+`)
+	for n := 0; n < 16; n++ {
+		sb.WriteString(entry(fmt.Sprintf("Ansi %d Color", n), testSchemeColor(n)))
+	}
+	sb.WriteString(entry("Foreground Color", testFg))
+	sb.WriteString(entry("Background Color", testBg))
+	sb.WriteString("</dict>\n</plist>\n")
+	return sb.String()
+}
+
+func windowsTerminalFixture() string {
+	body := schemeLines(func(_ int, name, hex string) string {
+		return fmt.Sprintf(`"%s": "#%s",`, strings.Replace(name, "magenta", "purple", 1), hex)
+	})
+	body = strings.ReplaceAll(body, "Magenta", "Purple")
+	return `{"schemes": [{"name": "Test", ` + body +
+		`"foreground": "#010203", "background": "#040506", "cursorColor": "#FFFFFF"}]}`
+}
+
+// windowsTerminalSettingsFixture is the scheme in a settings file as
+// Windows Terminal writes it, with comments and trailing commas.
+func windowsTerminalSettingsFixture() string {
+	fixture := windowsTerminalFixture()
+	return "// Settings\n{\n  \"$schema\": \"https://aka.ms/terminal-profiles-schema\", // url\n" +
+		"  /* schemes */ " + strings.TrimPrefix(strings.TrimSuffix(fixture, "}"), "{") +
+		",\n  \"actions\": [\"a//b\", \"c/*d*/\",],\n}\n"
+}
+
+func xresourcesFixture() string {
+	return "! comment\n#define fg #010203\n*.foreground: fg\nURxvt*background: rgb:04/05/06\n" +
+		schemeLines(func(n int, _, hex string) string {
+			return fmt.Sprintf("*color%d: #%s", n, hex)
+		})
+}
+
+func kittyFixture() string {
+	return "# theme\nforeground #010203\nbackground #040506\nselection_foreground none\n" +
+		schemeLines(func(n int, _, hex string) string {
+			return fmt.Sprintf("color%d  #%s", n, hex)
+		})
+}
+
+func alacrittyTOMLFixture() string {
+	var sb strings.Builder
+	sb.WriteString("[colors.primary]\nforeground = '#010203' # fg\nbackground = \"#040506\"\n")
+	sb.WriteString("[colors.normal]\n")
+	sb.WriteString(schemeLines(func(n int, name, hex string) string {
+		if n == 8 {
+			return fmt.Sprintf("[colors.bright]\n%s = '#%s'", colorNames[0], hex)
+		}
+		return fmt.Sprintf("%s = '#%s'", colorNames[n%8], hex)
+	}))
+	return sb.String()
+}
+
+func alacrittyYAMLFixture() string {
+	var sb strings.Builder
+	sb.WriteString("colors:\n  primary:\n    foreground: '0x010203'\n    background: '0x040506'\n")
+	sb.WriteString("  normal:\n")
+	sb.WriteString(schemeLines(func(n int, _, hex string) string {
+		line := fmt.Sprintf("    %s: '0x%s'", colorNames[n%8], hex)
+		if n == 8 {
+			return "  bright:\n" + line
+		}
+		return line
+	}))
+	return sb.String()
+}
+
+func TestParseScheme(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		format SchemeFormat
+		input  string
+	}{
+		{SchemeITerm2, iTermFixture()},
+		{SchemeWindowsTerminal, windowsTerminalFixture()},
+		{SchemeWindowsTerminal, windowsTerminalSettingsFixture()},
+		{SchemeXresources, xresourcesFixture()},
+		{SchemeKitty, kittyFixture()},
+		{SchemeAlacrittyTOML, alacrittyTOMLFixture()},
+		{SchemeAlacrittyYAML, alacrittyYAMLFixture()},
+	}
+	for _, tt := range tests {
+		scheme, err := ParseScheme(strings.NewReader(tt.input), tt.format)
+		if err != nil {
+			t.Errorf("%s: failed to parse: %v", tt.format, err)
+			continue
+		}
+		for n, c := range scheme.Colors {
+			if c != testSchemeColor(n) {
+				t.Errorf("%s: color %d is %v, expected %v",
+					tt.format, n, c, testSchemeColor(n))
+			}
+		}
+		if scheme.Foreground != testFg || scheme.Background != testBg {
+			t.Errorf("%s: expected fg %v bg %v, got %v %v", tt.format,
+				testFg, testBg, scheme.Foreground, scheme.Background)
+		}
+	}
+}
+
+func TestParseBase16(t *testing.T) {
+	t.Parallel()
+
+	input := `scheme: "Test"
+author: "Someone"
+base00: "000000"
+base01: "111111"
+base02: "222222"
+base03: "333333"
+base04: "444444"
+base05: "555555"
+base06: "666666"
+base07: "777777"
+base08: "888888"
+base09: "999999"
+base0A: "aaaaaa"
+base0B: "bbbbbb"
+base0C: "cccccc"
+base0D: "dddddd"
+base0E: "eeeeee"
+base0F: "ffffff"
+`
+	scheme, err := ParseScheme(strings.NewReader(input), SchemeBase16)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if scheme.Name != "Test" {
+		t.Errorf("Expected name Test, got %q", scheme.Name)
+	}
+	want := map[int]RGB{
+		0: {0, 0, 0}, 1: {0x88, 0x88, 0x88}, 4: {0xdd, 0xdd, 0xdd},
+		7: {0x55, 0x55, 0x55}, 8: {0x33, 0x33, 0x33}, 15: {0x77, 0x77, 0x77},
+	}
+	for n, c := range want {
+		if scheme.Colors[n] != c {
+			t.Errorf("Color %d is %v, expected %v", n, scheme.Colors[n], c)
+		}
+	}
+	if scheme.Foreground != want[7] || scheme.Background != want[0] {
+		t.Errorf("Unexpected fg %v bg %v", scheme.Foreground, scheme.Background)
+	}
+}
+
+func TestParseSchemeErrors(t *testing.T) {
+	t.Parallel()
+
+	if _, err := ParseScheme(strings.NewReader("color0 #000000\n"), SchemeKitty); err == nil {
+		t.Error("Expected an error for a scheme missing colors")
+	}
+	if _, err := ParseScheme(strings.NewReader("color0 #00000g\n"), SchemeKitty); err == nil {
+		t.Error("Expected an error for an invalid color")
+	}
+	if _, err := ParseScheme(strings.NewReader(""), "vt100"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestParseSchemeColor(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]RGB{
+		"#1d1f21":      {0x1d, 0x1f, 0x21},
+		"'0x1D1F21'":   {0x1d, 0x1f, 0x21},
+		`"1d1f21"`:     {0x1d, 0x1f, 0x21},
+		"#fff":         {0xff, 0xff, 0xff},
+		"rgb:ff/80/00": {0xff, 0x80, 0x00},
+		"rgb:ffff/0/8": {0xff, 0x00, 0x88},
+		" #000000 ":    {0, 0, 0},
+	}
+	for input, want := range tests {
+		got, err := parseSchemeColor(input)
+		if err != nil || got != want {
+			t.Errorf("parseSchemeColor(%q) = %v, %v; expected %v", input, got, err, want)
+		}
+	}
+	for _, input := range []string{"", "#12345", "red", "rgb:ff/ff"} {
+		if _, err := parseSchemeColor(input); err == nil {
+			t.Errorf("Expected an error for %q", input)
+		}
+	}
+}
+
+func TestDetectSchemeFormat(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		path string
+		data string
+		want SchemeFormat
+	}{
+		{"Dracula.itermcolors", "", SchemeITerm2},
+		{"settings.json", `{"schemes": []}`, SchemeWindowsTerminal},
+		{"campbell.json", `{"brightBlack": "#767676"}`, SchemeWindowsTerminal},
+		{"ansi16.json", `{"30": "#000000"}`, ""},
+		{"settings.json", windowsTerminalSettingsFixture(), SchemeWindowsTerminal},
+		{"xresources-foo.json", `{"30": "#000000"}`, ""},
+		{"kitty.palette", "", ""},
+		{"xresources.palette", "", ""},
+		{"kitty-theme", "", SchemeKitty},
+		{"theme.toml", "", SchemeAlacrittyTOML},
+		{"alacritty.yml", "colors:", SchemeAlacrittyYAML},
+		{"ocean.yaml", "base0D: \"8fa1b3\"", SchemeBase16},
+		{"gruvbox.conf", "", SchemeKitty},
+		{".Xresources", "", SchemeXresources},
+		{"colors.Xresources", "", SchemeXresources},
+		{"xresources-dark", "", SchemeXresources},
+		{"ansi16", "", ""},
+	}
+	for _, tt := range tests {
+		if got := DetectSchemeFormat(tt.path, []byte(tt.data)); got != tt.want {
+			t.Errorf("DetectSchemeFormat(%q) = %q, expected %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestSchemeAnsiData(t *testing.T) {
+	t.Parallel()
+
+	scheme, err := ParseScheme(strings.NewReader(kittyFixture()), SchemeKitty)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	fg, bg, err := scheme.AnsiData(16)
+	if err != nil {
+		t.Fatalf("AnsiData(16) failed: %v", err)
+	}
+	if len(fg) != 16 || len(bg) != 16 {
+		t.Fatalf("Expected 16 colors, got %d and %d", len(fg), len(bg))
+	}
+	if fg[1].Value != "31" || fg[1].Key != testSchemeColor(1).toUint32() {
+		t.Errorf("Unexpected fg entry %v", fg[1])
+	}
+	if bg[9].Value != "101" || bg[9].Key != testSchemeColor(9).toUint32() {
+		t.Errorf("Unexpected bg entry %v", bg[9])
+	}
+
+	fg, bg, err = scheme.AnsiData(256)
+	if err != nil {
+		t.Fatalf("AnsiData(256) failed: %v", err)
+	}
+	if len(fg) != 256 || len(bg) != 256 {
+		t.Fatalf("Expected 256 colors, got %d and %d", len(fg), len(bg))
+	}
+	if fg[3].Value != "38;5;3" || fg[3].Key != testSchemeColor(3).toUint32() {
+		t.Errorf("Unexpected fg entry %v", fg[3])
+	}
+	// The cube and grays are xterm's
+	if bg[196].Value != "48;5;196" || bg[196].Key != (RGB{255, 0, 0}).toUint32() {
+		t.Errorf("Unexpected bg entry %v", bg[196])
+	}
+	if fg[232].Key != (RGB{8, 8, 8}).toUint32() {
+		t.Errorf("Unexpected fg entry %v", fg[232])
+	}
+
+	if _, _, err := scheme.AnsiData(8); err == nil {
+		t.Error("Expected an error for 8 colors")
+	}
+}
+
+func TestLoadPaletteScheme(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "test.conf")
+	if err := os.WriteFile(path, []byte(kittyFixture()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := NewRenderer()
+	if err := r.LoadPalette(path); err != nil {
+		t.Fatalf("Failed to load scheme: %v", err)
+	}
+	if r.fgAnsi.Len() != 16 {
+		t.Errorf("Expected 16 foreground colors, got %d", r.fgAnsi.Len())
+	}
+	code, ok := r.fgAnsiRev["31"]
+	if !ok || code != testSchemeColor(1).toUint32() {
+		t.Errorf("Expected code 31 to be %v", testSchemeColor(1))
+	}
+	// The lookup table maps every color into the scheme
+	if r.fgClosestColor == nil {
+		t.Fatal("Expected lookup tables to be computed")
+	}
+	inScheme := make(map[RGB]bool)
+	for n := 0; n < 16; n++ {
+		inScheme[testSchemeColor(n)] = true
+	}
+	for _, c := range []RGB{{0, 0, 0}, {255, 255, 255}, {200, 30, 90}} {
+		if closest := (*r.fgClosestColor)[c.toUint32()]; !inScheme[closest] {
+			t.Errorf("Closest color to %v is %v, not a scheme color", c, closest)
+		}
+	}
+}
+
+func TestParseColorReplies(t *testing.T) {
+	t.Parallel()
+
+	var reply strings.Builder
+	for n := 0; n < 16; n++ {
+		c := testSchemeColor(n)
+		// Terminals answer with 16 bits per component, ended by BEL or ST
+		end := "\x07"
+		if n%2 == 1 {
+			end = "\x1b\\"
+		}
+		fmt.Fprintf(&reply, "\x1b]4;%d;rgb:%02x%02x/%02x%02x/%02x%02x%s",
+			n, c.R, c.R, c.G, c.G, c.B, c.B, end)
+	}
+	reply.WriteString("\x1b]4;196;rgb:eeee/0000/0000\x07")
+	reply.WriteString("\x1b]10;rgb:0101/0202/0303\x07\x1b]11;rgb:0404/0505/0606\x1b\\")
+	reply.WriteString("\x1b[?62;22c")
+
+	scheme, err := ParseColorReplies([]byte(reply.String()))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	for n, c := range scheme.Colors {
+		if c != testSchemeColor(n) {
+			t.Errorf("Color %d is %v, expected %v", n, c, testSchemeColor(n))
+		}
+	}
+	if scheme.Foreground != testFg || scheme.Background != testBg {
+		t.Errorf("Expected fg %v bg %v, got %v %v",
+			testFg, testBg, scheme.Foreground, scheme.Background)
+	}
+
+	// Extended colors replace xterm's in 256 color palettes
+	fg, _, err := scheme.AnsiData(256)
+	if err != nil {
+		t.Fatalf("AnsiData(256) failed: %v", err)
+	}
+	if fg[196].Key != (RGB{0xee, 0, 0}).toUint32() {
+		t.Errorf("Expected color 196 from the reply, got %06x", fg[196].Key)
+	}
+	if fg[197].Key != xtermColor(197).toUint32() {
+		t.Errorf("Expected xterm's color 197, got %06x", fg[197].Key)
+	}
+
+	// A terminal that doesn't answer OSC 4 only sends its attributes
+	if _, err := ParseColorReplies([]byte("\x1b[?1;2c")); err == nil {
+		t.Error("Expected an error without color replies")
+	}
+}
+
+func TestTableCache(t *testing.T) {
+	t.Parallel()
+
+	scheme, err := ParseScheme(strings.NewReader(kittyFixture()), SchemeKitty)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	fgData, bgData, err := scheme.AnsiData(16)
+	if err != nil {
+		t.Fatalf("AnsiData(16) failed: %v", err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "tables")
+	r := NewRenderer(WithTableCache(dir))
+	if err := r.LoadPaletteData("test", fgData, bgData); err != nil {
+		t.Fatalf("Failed to load palette: %v", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.palette"))
+	if len(files) != 1 {
+		t.Fatalf("Expected one cached table file, got %v", files)
+	}
+	if !r.UsingPrecomputedTables() {
+		t.Error("Expected the cached tables to be used")
+	}
+
+	// Tables computed without a cache don't come from a .palette file
+	uncached := NewRenderer()
+	if err := uncached.LoadPaletteData("test", fgData, bgData); err != nil {
+		t.Fatalf("Failed to load palette: %v", err)
+	}
+	if uncached.UsingPrecomputedTables() {
+		t.Error("Expected computed tables not to count as precomputed")
+	}
+	if !uncached.HasLookupTables() {
+		t.Error("Expected computed tables to be used for lookups")
+	}
+
+	// The second load reads the tables back, including for a new name
+	info, _ := os.Stat(files[0])
+	r2 := NewRenderer(WithTableCache(dir))
+	if err := r2.LoadPaletteData("again", fgData, bgData); err != nil {
+		t.Fatalf("Failed to load cached palette: %v", err)
+	}
+	if !reflect.DeepEqual(r.fgColors, r2.fgColors) {
+		t.Error("Cached palette colors differ")
+	}
+	if after, _ := os.Stat(files[0]); !after.ModTime().Equal(info.ModTime()) {
+		t.Error("Expected the cached tables to be reused, not rewritten")
+	}
+
+	// Another color method adds its tables to the same file
+	r3 := NewRenderer(WithTableCache(dir), WithColorMethod(RGBMethod{}))
+	if err := r3.LoadPaletteData("rgb", fgData, bgData); err != nil {
+		t.Fatalf("Failed to load palette: %v", err)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmct, err := decodePaletteTables(data)
+	if err != nil {
+		t.Fatalf("Failed to decode cached tables: %v", err)
+	}
+	if _, ok := cmct["RGB"]; !ok || len(cmct) != 2 {
+		t.Errorf("Expected tables for 2 methods, got %d", len(cmct))
+	}
+}
@@ -0,0 +1,220 @@
+package img2ansi
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/wbrown/img2ansi/imageutil"
+)
+
+// SixelOptions controls the Sixel stream produced by EncodeSixel.
+type SixelOptions struct {
+	// CellWidth is the width in Sixel pixels of the character cell that
+	// a 2x2 block of image pixels would occupy as block characters.
+	CellWidth int
+	// ScaleFactor is the cell height divided by its width, as in
+	// Renderer.ScaleFactor.
+	ScaleFactor float64
+	// Dither diffuses the quantization error with the same
+	// Floyd-Steinberg kernel as BrownDitherForBlocks, reduced on edges.
+	Dither bool
+}
+
+// DefaultSixelOptions returns the options used when fields are left zero:
+// 8 pixel wide cells twice as tall as they are wide, so the image covers
+// the same area as its block character rendering.
+func DefaultSixelOptions() SixelOptions {
+	return SixelOptions{
+		CellWidth:   8,
+		ScaleFactor: 2.0,
+	}
+}
+
+// withDefaults fills zero fields from DefaultSixelOptions.
+func (o SixelOptions) withDefaults() SixelOptions {
+	d := DefaultSixelOptions()
+	if o.CellWidth <= 0 {
+		o.CellWidth = d.CellWidth
+	}
+	if o.ScaleFactor <= 0 {
+		o.ScaleFactor = d.ScaleFactor
+	}
+	return o
+}
+
+// sixelPalette returns the distinct colors of the Renderer's foreground
+// and background palettes. Sixel pixels have no foreground or background,
+// so both sets are available to every pixel.
+func (r *Renderer) sixelPalette() []RGB {
+	var palette []RGB
+	seen := make(map[RGB]bool)
+	for _, colors := range [][]RGB{r.fgColors, r.bgColors} {
+		for _, c := range colors {
+			if !seen[c] {
+				seen[c] = true
+				palette = append(palette, c)
+			}
+		}
+	}
+	return palette
+}
+
+// quantizeImage maps every pixel of img to the index of its nearest
+// palette color, diffusing the error into img if dither is set. The
+// result is indexed [y][x].
+func (r *Renderer) quantizeImage(
+	img *imageutil.RGBAImage,
+	edges *imageutil.GrayImage,
+	palette []RGB,
+	dither bool,
+) [][]int {
+	nearest := make(map[RGB]int)
+	lookup := func(c RGB) int {
+		if idx, ok := nearest[c]; ok {
+			return idx
+		}
+		best, bestDistance := 0, math.MaxFloat64
+		for i, p := range palette {
+			if d := r.ColorMethod.Distance(c, p); d < bestDistance {
+				best, bestDistance = i, d
+			}
+		}
+		nearest[c] = best
+		return best
+	}
+
+	height, width := img.Height(), img.Width()
+	indices := make([][]int, height)
+	for y := 0; y < height; y++ {
+		indices[y] = make([]int, width)
+		for x := 0; x < width; x++ {
+			c := rgbFromImageutil(img.GetRGB(x, y))
+			idx := lookup(c)
+			indices[y][x] = idx
+			if dither {
+				isEdge := edges != nil && edges.GrayAt(x, y).Y > 128
+				distributeError(img, y, x,
+					c.subtractToError(palette[idx]), isEdge)
+			}
+		}
+	}
+	return indices
+}
+
+// EncodeSixel writes img as a DECSIXEL graphic quantized to the Renderer's
+// palette, which is sent as color registers ahead of the pixel data. It
+// takes the output of imageutil.PrepareForANSI, so the same preprocessing
+// can drive both block character and bitmap output. Each image pixel is
+// drawn as a rectangle of half a cell, keeping the on-screen size and
+// aspect of the block rendering. edges may be nil; with opts.Dither it
+// reduces error diffusion across edges as in BrownDitherForBlocks.
+//
+// img is left unchanged. Most terminals offer at least 256 color
+// registers, enough for the embedded palettes.
+func (r *Renderer) EncodeSixel(
+	w io.Writer,
+	img *imageutil.RGBAImage,
+	edges *imageutil.GrayImage,
+	opts SixelOptions,
+) error {
+	if img == nil || img.Width() == 0 || img.Height() == 0 {
+		return fmt.Errorf("cannot encode an empty image")
+	}
+	opts = opts.withDefaults()
+	palette := r.sixelPalette()
+	if len(palette) == 0 {
+		return fmt.Errorf("no palette loaded")
+	}
+	indices := r.quantizeImage(img.Clone(), edges, palette, opts.Dither)
+
+	pixelWidth := max(opts.CellWidth/2, 1)
+	pixelHeight := max(int(math.Round(
+		float64(opts.CellWidth)*opts.ScaleFactor/2)), 1)
+	width := img.Width() * pixelWidth
+	height := img.Height() * pixelHeight
+
+	bw := bufio.NewWriter(w)
+	// P2=1 leaves unpainted pixels alone, though every pixel is painted
+	fmt.Fprintf(bw, "%sP0;1;0q\"1;1;%d;%d", ESC, width, height)
+	for i, c := range palette {
+		fmt.Fprintf(bw, "#%d;2;%d;%d;%d", i,
+			sixelPercent(c.R), sixelPercent(c.G), sixelPercent(c.B))
+	}
+
+	for band := 0; band < height; band += 6 {
+		if band > 0 {
+			bw.WriteByte('-')
+		}
+		rows := min(6, height-band)
+		// Collect each color's six-pixel columns in this band
+		masks := make(map[int][]byte)
+		var order []int
+		for x := 0; x < width; x++ {
+			for dy := 0; dy < rows; dy++ {
+				idx := indices[(band+dy)/pixelHeight][x/pixelWidth]
+				mask, ok := masks[idx]
+				if !ok {
+					mask = make([]byte, width)
+					masks[idx] = mask
+					order = append(order, idx)
+				}
+				mask[x] |= 1 << dy
+			}
+		}
+		for i, idx := range order {
+			if i > 0 {
+				bw.WriteByte('$')
+			}
+			fmt.Fprintf(bw, "#%d", idx)
+			writeSixelRuns(bw, masks[idx])
+		}
+	}
+
+	bw.WriteString(ESC + "\\")
+	return bw.Flush()
+}
+
+// RenderToSixel renders img to a DECSIXEL string.
+func (r *Renderer) RenderToSixel(
+	img *imageutil.RGBAImage,
+	edges *imageutil.GrayImage,
+	opts SixelOptions,
+) (string, error) {
+	var sb strings.Builder
+	err := r.EncodeSixel(&sb, img, edges, opts)
+	return sb.String(), err
+}
+
+// writeSixelRuns writes one color's row of sixels, using the repeat
+// introducer for runs long enough to save space. Trailing empty sixels
+// are dropped.
+func writeSixelRuns(w *bufio.Writer, mask []byte) {
+	end := len(mask)
+	for end > 0 && mask[end-1] == 0 {
+		end--
+	}
+	for x := 0; x < end; {
+		n := 1
+		for x+n < end && mask[x+n] == mask[x] {
+			n++
+		}
+		ch := byte(63 + mask[x])
+		if n > 3 {
+			fmt.Fprintf(w, "!%d%c", n, ch)
+		} else {
+			for i := 0; i < n; i++ {
+				w.WriteByte(ch)
+			}
+		}
+		x += n
+	}
+}
+
+// sixelPercent converts a color channel to the 0-100 scale of Sixel color
+// registers.
+func sixelPercent(v uint8) int {
+	return int(math.Round(float64(v) * 100 / 255))
+}
@@ -0,0 +1,99 @@
+package img2ansi
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/wbrown/img2ansi/imageutil"
+)
+
+func TestEncodeSixel(t *testing.T) {
+	t.Parallel()
+
+	r := NewRenderer(WithPalette("ansi16"))
+	img := imageutil.NewRGBAImage(2, 1)
+	img.SetRGB(0, 0, imageutil.RGB{R: 0xAA})
+	img.SetRGB(1, 0, imageutil.RGB{R: 0xF0, G: 0xF0, B: 0xF0})
+
+	out, err := r.RenderToSixel(img, nil, SixelOptions{CellWidth: 4, ScaleFactor: 2})
+	if err != nil {
+		t.Fatalf("Failed to encode Sixel: %v", err)
+	}
+
+	if !strings.HasPrefix(out, ESC+"P0;1;0q\"1;1;4;4") {
+		t.Errorf("Expected DCS header with 4x4 raster attributes, got %q", out)
+	}
+	if !strings.HasSuffix(out, ESC+"\\") {
+		t.Errorf("Expected string terminator, got %q", out)
+	}
+
+	palette := r.sixelPalette()
+	red, white := -1, -1
+	for i, c := range palette {
+		switch c {
+		case RGB{0xAA, 0, 0}:
+			red = i
+		case RGB{0xFF, 0xFF, 0xFF}:
+			white = i
+		}
+	}
+	if red < 0 || white < 0 {
+		t.Fatalf("Expected red and white in the palette, got %v", palette)
+	}
+	// Each pixel is 2x4 Sixel pixels: the first four rows of the band
+	// (mask 0b1111, '?'+15 = 'N') in two columns per color.
+	for _, want := range []string{
+		"#" + strconv.Itoa(red) + ";2;67;0;0",
+		"#" + strconv.Itoa(white) + ";2;100;100;100",
+		"#" + strconv.Itoa(red) + "NN$#" + strconv.Itoa(white) + "??NN",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in %q", want, out)
+		}
+	}
+
+	if _, err := r.RenderToSixel(imageutil.NewRGBAImage(0, 0), nil, SixelOptions{}); err == nil {
+		t.Error("Expected error for empty image")
+	}
+}
+
+func TestEncodeSixelDither(t *testing.T) {
+	t.Parallel()
+
+	r := NewRenderer(WithPalette("ansi16"))
+	img := imageutil.NewRGBAImage(8, 6)
+	for y := 0; y < 6; y++ {
+		for x := 0; x < 8; x++ {
+			img.SetRGB(x, y, imageutil.RGB{R: 0x40, G: 0x40, B: 0x40})
+		}
+	}
+	original := img.Clone()
+
+	palette := r.sixelPalette()
+	flat := r.quantizeImage(img.Clone(), nil, palette, false)
+	dithered := r.quantizeImage(img.Clone(), nil, palette, true)
+
+	count := func(indices [][]int) int {
+		used := make(map[int]bool)
+		for _, row := range indices {
+			for _, idx := range row {
+				used[idx] = true
+			}
+		}
+		return len(used)
+	}
+	if n := count(flat); n != 1 {
+		t.Errorf("Expected a flat area to quantize to one color, got %d", n)
+	}
+	if n := count(dithered); n < 2 {
+		t.Errorf("Expected dithering to mix colors, got %d", n)
+	}
+
+	if _, err := r.RenderToSixel(img, nil, SixelOptions{Dither: true}); err != nil {
+		t.Fatalf("Failed to encode Sixel: %v", err)
+	}
+	if string(img.Pix) != string(original.Pix) {
+		t.Error("EncodeSixel should not modify the input image")
+	}
+}
@@ -0,0 +1,116 @@
+package img2ansi
+
+import (
+	"image"
+	"math"
+
+	"github.com/wbrown/img2ansi/imageutil"
+)
+
+// SizeMode selects how TargetWidth and TargetHeight size the output. Sizes
+// are in terminal cells; ScaleFactor is the height of a cell over its
+// width, so that the image keeps its aspect ratio on screen.
+type SizeMode int
+
+const (
+	// SizeWidth renders TargetWidth columns, with as many rows as the
+	// image's aspect ratio needs.
+	SizeWidth SizeMode = iota
+	// SizeHeight renders TargetHeight rows, with as many columns as the
+	// image's aspect ratio needs.
+	SizeHeight
+	// SizeFit renders the largest size that fits within TargetWidth
+	// columns and TargetHeight rows.
+	SizeFit
+	// SizeFill renders exactly TargetWidth columns and TargetHeight rows,
+	// cropping the image evenly on the sides that don't fit.
+	SizeFill
+)
+
+// GridSize returns the columns and rows an image of the given size in
+// pixels renders to, and the part of the image that is shown. The modes
+// that need TargetHeight fall back to SizeWidth if it isn't set.
+func (r *Renderer) GridSize(width, height int) (cols, rows int, crop image.Rectangle) {
+	crop = image.Rect(0, 0, width, height)
+	if width <= 0 || height <= 0 {
+		return 0, 0, crop
+	}
+	// Columns per row that keep the aspect ratio
+	aspect := float64(width) / float64(height) * r.ScaleFactor
+	colsFor := func(rows int) int { return max(1, int(float64(rows)*aspect)) }
+	rowsFor := func(cols int) int { return max(1, int(float64(cols)/aspect)) }
+
+	mode := r.SizeMode
+	if r.TargetHeight <= 0 {
+		mode = SizeWidth
+	}
+	switch mode {
+	case SizeHeight:
+		return colsFor(r.TargetHeight), r.TargetHeight, crop
+	case SizeFit:
+		cols, rows = r.TargetWidth, rowsFor(r.TargetWidth)
+		if rows > r.TargetHeight {
+			cols, rows = colsFor(r.TargetHeight), r.TargetHeight
+		}
+		return min(cols, r.TargetWidth), rows, crop
+	case SizeFill:
+		box := float64(r.TargetWidth) / float64(r.TargetHeight)
+		if aspect > box {
+			// Too wide: crop the sides
+			w := int(math.Round(float64(width) * box / aspect))
+			crop = image.Rect((width-w)/2, 0, (width-w)/2+w, height)
+		} else {
+			// Too tall: crop the top and bottom
+			h := int(math.Round(float64(height) * aspect / box))
+			crop = image.Rect(0, (height-h)/2, width, (height-h)/2+h)
+		}
+		return r.TargetWidth, r.TargetHeight, crop
+	}
+	return r.TargetWidth, rowsFor(r.TargetWidth), crop
+}
+
+// viewRect returns the part of an image with the given bounds that is
+// rendered before sizing: the Crop rectangle, if it is set, narrowed by
+// Zoom around the focus point. The zoomed area is moved as needed to stay
+// inside the cropped one.
+func (r *Renderer) viewRect(bounds image.Rectangle) image.Rectangle {
+	view := bounds
+	if !r.Crop.Empty() {
+		view = r.Crop.Intersect(bounds)
+		if view.Empty() {
+			view = bounds
+		}
+	}
+	if r.Zoom <= 1 {
+		return view
+	}
+
+	w := max(1, int(math.Round(float64(view.Dx())/r.Zoom)))
+	h := max(1, int(math.Round(float64(view.Dy())/r.Zoom)))
+	cx := view.Min.X + int(math.Round(r.FocusX*float64(view.Dx())))
+	cy := view.Min.Y + int(math.Round(r.FocusY*float64(view.Dy())))
+	x := min(max(cx-w/2, view.Min.X), view.Max.X-w)
+	y := min(max(cy-h/2, view.Min.Y), view.Max.Y-h)
+	return image.Rect(x, y, x+w, y+h)
+}
+
+// layout returns the grid size for an image with the given bounds and the
+// part of it that is shown, after Crop, Zoom and the sizing mode.
+func (r *Renderer) layout(bounds image.Rectangle) (cols, rows int, shown image.Rectangle) {
+	view := r.viewRect(bounds)
+	cols, rows, crop := r.GridSize(view.Dx(), view.Dy())
+	return cols, rows, crop.Add(view.Min)
+}
+
+// PrepareImage crops img to the part that is shown, at full resolution so
+// no detail is lost, then resizes it to the size GridSize gives and
+// detects its edges, ready for BrownDitherForBlocks.
+func (r *Renderer) PrepareImage(
+	img *imageutil.RGBAImage,
+) (*imageutil.RGBAImage, *imageutil.GrayImage) {
+	cols, rows, shown := r.layout(img.Bounds())
+	if shown != img.Bounds() {
+		img = imageutil.Crop(img, shown)
+	}
+	return imageutil.PrepareForANSI(img, cols, rows)
+}
@@ -0,0 +1,124 @@
+package img2ansi
+
+import (
+	"image"
+	"testing"
+)
+
+func TestGridSize(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		mode          SizeMode
+		width, height int // target
+		imgW, imgH    int
+		cols, rows    int
+		crop          image.Rectangle
+	}{
+		{"width", SizeWidth, 80, 0, 400, 200, 80, 20, image.Rect(0, 0, 400, 200)},
+		{"height", SizeHeight, 80, 10, 400, 200, 40, 10, image.Rect(0, 0, 400, 200)},
+		{"height unset", SizeHeight, 80, 0, 400, 200, 80, 20, image.Rect(0, 0, 400, 200)},
+		{"fit wide", SizeFit, 80, 40, 400, 200, 80, 20, image.Rect(0, 0, 400, 200)},
+		{"fit tall", SizeFit, 80, 10, 400, 200, 40, 10, image.Rect(0, 0, 400, 200)},
+		{"fill wide", SizeFill, 40, 20, 400, 200, 40, 20, image.Rect(100, 0, 300, 200)},
+		{"fill tall", SizeFill, 80, 10, 400, 200, 80, 10, image.Rect(0, 50, 400, 150)},
+	}
+	for _, tt := range tests {
+		r := NewRenderer(WithTargetWidth(tt.width), WithTargetHeight(tt.height),
+			WithSizeMode(tt.mode))
+		cols, rows, crop := r.GridSize(tt.imgW, tt.imgH)
+		if cols != tt.cols || rows != tt.rows || crop != tt.crop {
+			t.Errorf("%s: got %dx%d %v, want %dx%d %v", tt.name,
+				cols, rows, crop, tt.cols, tt.rows, tt.crop)
+		}
+	}
+}
+
+func TestSizeModeRender(t *testing.T) {
+	t.Parallel()
+
+	r := NewRenderer(WithPalette("ansi16"), WithTargetWidth(12),
+		WithTargetHeight(6), WithSizeMode(SizeFill))
+	result, err := r.RenderImage(gradientImage(80, 20))
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	if result.Width != 12 || result.Height != 6 {
+		t.Errorf("Expected 12x6, got %dx%d", result.Width, result.Height)
+	}
+
+	r.SizeMode = SizeHeight
+	result, err = r.RenderImage(gradientImage(80, 20))
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	if result.Width != 48 || result.Height != 6 {
+		t.Errorf("Expected 48x6, got %dx%d", result.Width, result.Height)
+	}
+}
+
+func TestWithCellSize(t *testing.T) {
+	t.Parallel()
+
+	r := NewRenderer(WithTargetWidth(90), WithCellSize(9, 19))
+	if r.ScaleFactor != 19.0/9.0 {
+		t.Errorf("Expected ScaleFactor %v, got %v", 19.0/9.0, r.ScaleFactor)
+	}
+	// 9x19 cells are taller than 8x16 ones, so a square needs fewer rows
+	if cols, rows, _ := r.GridSize(400, 400); cols != 90 || rows != 42 {
+		t.Errorf("Expected 90x42, got %dx%d", cols, rows)
+	}
+
+	r = NewRenderer(WithCellSize(0, 19))
+	if r.ScaleFactor != 2.0 {
+		t.Errorf("Expected the default ScaleFactor, got %v", r.ScaleFactor)
+	}
+}
+
+func TestViewRect(t *testing.T) {
+	t.Parallel()
+
+	bounds := image.Rect(0, 0, 400, 200)
+	tests := []struct {
+		name string
+		opts []RendererOption
+		want image.Rectangle
+	}{
+		{"whole", nil, bounds},
+		{"crop", []RendererOption{WithCrop(image.Rect(50, 20, 150, 120))},
+			image.Rect(50, 20, 150, 120)},
+		{"crop outside", []RendererOption{WithCrop(image.Rect(500, 0, 600, 100))},
+			bounds},
+		{"zoom", []RendererOption{WithZoom(2)}, image.Rect(100, 50, 300, 150)},
+		{"zoom focus", []RendererOption{WithZoom(4), WithFocus(0.25, 0.5)},
+			image.Rect(50, 75, 150, 125)},
+		{"zoom clamped", []RendererOption{WithZoom(2), WithFocus(1, 0)},
+			image.Rect(200, 0, 400, 100)},
+		{"crop and zoom", []RendererOption{
+			WithCrop(image.Rect(100, 0, 300, 200)), WithZoom(2)},
+			image.Rect(150, 50, 250, 150)},
+	}
+	for _, tt := range tests {
+		r := NewRenderer(tt.opts...)
+		if got := r.viewRect(bounds); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestCropRender(t *testing.T) {
+	t.Parallel()
+
+	// The crop is taken at full resolution, so a square part of a wide
+	// image renders square
+	r := NewRenderer(WithPalette("ansi16"), WithTargetWidth(10),
+		WithCrop(image.Rect(20, 0, 40, 20)))
+	result, err := r.RenderImage(gradientImage(80, 20))
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	if result.Width != 10 || result.Height != 5 {
+		t.Errorf("Expected 10x5, got %dx%d", result.Width, result.Height)
+	}
+}
@@ -0,0 +1,124 @@
+package img2ansi
+
+import (
+	"context"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/wbrown/img2ansi/imageutil"
+)
+
+// rowStreamer writes compressed ANSI rows to an io.Writer as they come.
+type rowStreamer struct {
+	w   io.Writer
+	e   *ansiEncoder
+	buf strings.Builder
+}
+
+// newRowStreamer returns a streamer writing to w with the Renderer's
+// palette and encoding options.
+func (r *Renderer) newRowStreamer(w io.Writer) *rowStreamer {
+	return &rowStreamer{w: w, e: newANSIEncoder(r)}
+}
+
+// writeRow encodes row, writes it and flushes w if it can be flushed.
+func (s *rowStreamer) writeRow(row []BlockRune) error {
+	s.e.writeRow(&s.buf, row)
+	return s.flush()
+}
+
+// finish writes the final reset, if one is pending, and flushes w.
+func (s *rowStreamer) finish() error {
+	s.e.finish(&s.buf)
+	return s.flush()
+}
+
+// flush writes the buffered text to w and flushes w. Both flushers that
+// return an error, like bufio.Writer, and ones that don't, like
+// http.ResponseWriter, are supported.
+func (s *rowStreamer) flush() error {
+	if s.buf.Len() > 0 {
+		_, err := io.WriteString(s.w, s.buf.String())
+		s.buf.Reset()
+		if err != nil {
+			return err
+		}
+	}
+	switch f := s.w.(type) {
+	case interface{ Flush() error }:
+		return f.Flush()
+	case interface{ Flush() }:
+		f.Flush()
+	}
+	return nil
+}
+
+// Encode writes blocks to w as compressed ANSI text, the same as
+// CompressBlocks returns, one row at a time instead of building the whole
+// string first.
+func (r *Renderer) Encode(w io.Writer, blocks [][]BlockRune) error {
+	s := r.newRowStreamer(w)
+	for _, row := range blocks {
+		if err := s.writeRow(row); err != nil {
+			return err
+		}
+	}
+	return s.finish()
+}
+
+// RenderStream dithers img like BrownDitherForBlocks and writes each row
+// to w as compressed ANSI text as soon as it is done, so output can be
+// shown while the rest of the image is still being rendered. If w has a
+// Flush method, as bufio.Writer and http.ResponseWriter do, it is called
+// after every row.
+//
+// RenderStream returns the rows it rendered; if writing fails, it stops
+// and returns the error with the rows written so far.
+func (r *Renderer) RenderStream(
+	w io.Writer,
+	img *imageutil.RGBAImage,
+	edges *imageutil.GrayImage,
+) ([][]BlockRune, error) {
+	s := r.newRowStreamer(w)
+	r.adaptPalette(img)
+	progress := r.newRenderMonitor(context.Background()).nextPass(img.Height() / 2)
+	blocks, err := r.ditherBlockRows(img, edges, r.chooser(r.RateLambda),
+		func(by int, row []BlockRune) error {
+			if err := s.writeRow(row); err != nil {
+				return err
+			}
+			return progress(by, row)
+		})
+	if err != nil {
+		return blocks, err
+	}
+	return blocks, s.finish()
+}
+
+// MaxANSIBytes returns the most bytes of compressed ANSI text that
+// CompressBlocks, Encode or RenderStream can write for a rendered grid of
+// cols by rows blocks: every cell setting both colors with the palette's
+// longest codes. If it is at most MaxChars, an image of that size can be
+// streamed without fitting it first.
+func (r *Renderer) MaxANSIBytes(cols, rows int) int {
+	fg, bg := longestCode(r.fgAnsi), longestCode(r.bgAnsi)
+	if r.AdaptiveColors > 0 {
+		// Adaptive palettes are written as 24-bit codes
+		fg = max(fg, len("38;2;255;255;255"))
+		bg = max(bg, len("48;2;255;255;255"))
+	}
+	cell := len(ESC) + fg + bg + 3 + utf8.UTFMax
+	return rows * (cols*cell + len(ESC+"[0m\n"))
+}
+
+// longestCode returns the length of the longest ANSI code in om.
+func longestCode(om *OrderedMap) int {
+	longest := 0
+	if om != nil {
+		om.Iterate(func(_, value interface{}) {
+			longest = max(longest, len(value.(string)))
+		})
+	}
+	return longest
+}
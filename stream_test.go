@@ -0,0 +1,104 @@
+package img2ansi
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/wbrown/img2ansi/imageutil"
+)
+
+// flushRecorder records what had been written at each Flush call.
+type flushRecorder struct {
+	bytes.Buffer
+	flushes []string
+}
+
+func (f *flushRecorder) Flush() {
+	f.flushes = append(f.flushes, f.String())
+}
+
+// failingWriter fails every write after the first n.
+type failingWriter struct {
+	n int
+}
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	if f.n == 0 {
+		return 0, errors.New("write failed")
+	}
+	f.n--
+	return len(p), nil
+}
+
+func TestRenderStream(t *testing.T) {
+	t.Parallel()
+
+	r := NewRenderer(WithPalette("ansi16"))
+	img := imageutil.NewRGBAImage(8, 6)
+	for y := 0; y < 6; y++ {
+		for x := 0; x < 8; x++ {
+			img.SetRGB(x, y, imageutil.RGB{R: uint8(x * 30), G: uint8(y * 40), B: 0x80})
+		}
+	}
+	edges := imageutil.NewGrayImage(8, 6)
+
+	expectedBlocks := r.BrownDitherForBlocks(img.Clone(), edges)
+	expected := r.CompressBlocks(expectedBlocks)
+
+	var out flushRecorder
+	blocks, err := r.RenderStream(&out, img.Clone(), edges)
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	if out.String() != expected {
+		t.Errorf("Streamed output differs:\n got %q\nwant %q", out.String(), expected)
+	}
+	if len(blocks) != 3 {
+		t.Errorf("Expected 3 rows of blocks, got %d", len(blocks))
+	}
+	// One flush per row plus the final one
+	if len(out.flushes) != 4 {
+		t.Fatalf("Expected 4 flushes, got %d", len(out.flushes))
+	}
+	for i, flushed := range out.flushes[:3] {
+		if strings.Count(flushed, "\n") != i+1 {
+			t.Errorf("Flush %d should follow row %d, got %q", i, i+1, flushed)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := r.Encode(&buf, expectedBlocks); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if buf.String() != expected {
+		t.Errorf("Encode differs from CompressBlocks:\n got %q\nwant %q", buf.String(), expected)
+	}
+
+	blocks, err = r.RenderStream(&failingWriter{n: 1}, img.Clone(), edges)
+	if err == nil {
+		t.Fatal("Expected the write error to be returned")
+	}
+	if len(blocks) != 2 {
+		t.Errorf("Expected rendering to stop after the failed row, got %d rows", len(blocks))
+	}
+}
+
+func TestMaxANSIBytes(t *testing.T) {
+	t.Parallel()
+
+	img := noiseImage(48, 32)
+	edges := imageutil.NewGrayImage(48, 32)
+	for _, r := range []*Renderer{
+		NewRenderer(WithPalette("ansi16")),
+		NewRenderer(WithPalette("ansi256"), WithLineReset(false)),
+		NewRenderer(WithAdaptivePalette(64, QuantizeMedianCut)),
+	} {
+		out := r.CompressBlocks(r.BrownDitherForBlocks(img.Clone(), edges))
+		if limit := r.MaxANSIBytes(24, 16); len(out) > limit {
+			t.Errorf("%s: output of %d bytes exceeds the bound %d",
+				r.palettePath, len(out), limit)
+		}
+	}
+}
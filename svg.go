@@ -0,0 +1,163 @@
+package img2ansi
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// SVGOptions controls the SVG produced by EncodeSVG.
+type SVGOptions struct {
+	// CellWidth is the width of one character cell in SVG user units.
+	CellWidth float64
+	// ScaleFactor is the cell height divided by its width, as in
+	// Renderer.ScaleFactor.
+	ScaleFactor float64
+}
+
+// DefaultSVGOptions returns the options used when fields are left zero.
+func DefaultSVGOptions() SVGOptions {
+	return SVGOptions{
+		CellWidth:   8,
+		ScaleFactor: 2.0,
+	}
+}
+
+// subpixelGrid expands blocks into their quadrant colors: a grid twice as
+// wide and twice as tall as the block grid, indexed [y][x].
+func subpixelGrid(blocks [][]BlockRune) [][]RGB {
+	grid := make([][]RGB, len(blocks)*2)
+	for by, row := range blocks {
+		grid[by*2] = make([]RGB, len(row)*2)
+		grid[by*2+1] = make([]RGB, len(row)*2)
+		for bx, block := range row {
+			quad := getQuadrantsForRune(block.Rune)
+			for i := 0; i < 4; i++ {
+				dx, dy := i%2, i/2
+				c := block.BG
+				if isQuadrantActive(quad, dx, dy) {
+					c = block.FG
+				}
+				grid[by*2+dy][bx*2+dx] = c
+			}
+		}
+	}
+	return grid
+}
+
+// svgRect is a rectangle of quadrants sharing one color.
+type svgRect struct {
+	x, y, w, h int
+}
+
+// mergeRects covers every quadrant that isn't the background color with
+// rectangles, greedily growing each one right and then down as far as the
+// color allows. The result is grouped by color in first-seen order.
+func mergeRects(grid [][]RGB, background RGB) ([]RGB, map[RGB][]svgRect) {
+	var order []RGB
+	rects := make(map[RGB][]svgRect)
+	if len(grid) == 0 {
+		return order, rects
+	}
+	height, width := len(grid), len(grid[0])
+	covered := make([][]bool, height)
+	for y := range covered {
+		covered[y] = make([]bool, width)
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := grid[y][x]
+			if covered[y][x] || c == background {
+				continue
+			}
+			w := 1
+			for x+w < width && !covered[y][x+w] && grid[y][x+w] == c {
+				w++
+			}
+			h := 1
+		grow:
+			for y+h < height {
+				for dx := 0; dx < w; dx++ {
+					if covered[y+h][x+dx] || grid[y+h][x+dx] != c {
+						break grow
+					}
+				}
+				h++
+			}
+			for dy := 0; dy < h; dy++ {
+				for dx := 0; dx < w; dx++ {
+					covered[y+dy][x+dx] = true
+				}
+			}
+			if _, seen := rects[c]; !seen {
+				order = append(order, c)
+			}
+			rects[c] = append(rects[c], svgRect{x, y, w, h})
+		}
+	}
+	return order, rects
+}
+
+// EncodeSVG writes blocks as an SVG image. Every cell's foreground
+// quadrants and background are drawn as rectangles; quadrants of the same
+// color are merged into larger rectangles, the most common color becomes
+// a single background rectangle, and each remaining color is emitted as
+// one path. The output is independent of fonts and scales to any size.
+func EncodeSVG(w io.Writer, blocks [][]BlockRune, opts SVGOptions) error {
+	defaults := DefaultSVGOptions()
+	if opts.CellWidth <= 0 {
+		opts.CellWidth = defaults.CellWidth
+	}
+	if opts.ScaleFactor <= 0 {
+		opts.ScaleFactor = defaults.ScaleFactor
+	}
+	if len(blocks) == 0 || len(blocks[0]) == 0 {
+		return fmt.Errorf("cannot encode an empty block grid")
+	}
+
+	grid := subpixelGrid(blocks)
+	qw := opts.CellWidth / 2
+	qh := opts.CellWidth * opts.ScaleFactor / 2
+	width := float64(len(grid[0])) * qw
+	height := float64(len(grid)) * qh
+
+	counts := make(map[RGB]int)
+	var background RGB
+	for _, row := range grid {
+		for _, c := range row {
+			counts[c]++
+			if counts[c] > counts[background] {
+				background = c
+			}
+		}
+	}
+	order, rects := mergeRects(grid, background)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "<svg xmlns=\"http://www.w3.org/2000/svg\" "+
+		"width=\"%g\" height=\"%g\" viewBox=\"0 0 %g %g\" "+
+		"shape-rendering=\"crispEdges\">\n", width, height, width, height)
+	fmt.Fprintf(bw, "<rect width=\"%g\" height=\"%g\" fill=\"#%s\"/>\n",
+		width, height, background.hex())
+	for _, c := range order {
+		var d strings.Builder
+		for _, rect := range rects[c] {
+			fmt.Fprintf(&d, "M%g %gh%gv%gh%gz",
+				float64(rect.x)*qw, float64(rect.y)*qh,
+				float64(rect.w)*qw, float64(rect.h)*qh,
+				-float64(rect.w)*qw)
+		}
+		fmt.Fprintf(bw, "<path fill=\"#%s\" d=\"%s\"/>\n", c.hex(), d.String())
+	}
+	fmt.Fprintf(bw, "</svg>\n")
+	return bw.Flush()
+}
+
+// RenderToSVG renders blocks to an SVG document string.
+func RenderToSVG(blocks [][]BlockRune, opts SVGOptions) (string, error) {
+	var sb strings.Builder
+	err := EncodeSVG(&sb, blocks, opts)
+	return sb.String(), err
+}
@@ -0,0 +1,36 @@
+package img2ansi
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncodeSVG(t *testing.T) {
+	t.Parallel()
+
+	black, red := RGB{0, 0, 0}, RGB{255, 0, 0}
+	blocks := [][]BlockRune{
+		{{'▐', red, black}, {'▌', red, black}, {' ', red, black}},
+		{{'▐', red, black}, {'▌', red, black}, {' ', red, black}},
+	}
+
+	out, err := RenderToSVG(blocks, SVGOptions{CellWidth: 10, ScaleFactor: 2})
+	if err != nil {
+		t.Fatalf("Failed to encode SVG: %v", err)
+	}
+
+	if !strings.Contains(out, `width="30" height="40"`) {
+		t.Errorf("Expected 30x40 image from 3x2 cells, got:\n%s", out)
+	}
+	if !strings.Contains(out, `<rect width="30" height="40" fill="#000000"/>`) {
+		t.Errorf("Expected black background rectangle, got:\n%s", out)
+	}
+	// The red halves of the first two columns join into one 10x40 rectangle
+	if !strings.Contains(out, `<path fill="#ff0000" d="M5 0h10v40h-10z"/>`) {
+		t.Errorf("Expected a single merged red rectangle, got:\n%s", out)
+	}
+
+	if _, err := RenderToSVG(nil, SVGOptions{}); err == nil {
+		t.Error("Expected error for empty grid")
+	}
+}